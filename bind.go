@@ -0,0 +1,140 @@
+package fatlisp
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Bind makes the Go value v available in the global scope of the context
+// under name. Functions are wrapped so that their arguments are converted
+// from fatlisp values to the Go parameter types, and their results back to
+// fatlisp values. A trailing error result is returned as the error of the
+// call. Structs and pointers to structs are bound as opaque objects whose
+// methods can be called with the . form:
+//
+//	(. obj Method arg1 arg2)
+//
+// Other values are converted to their fatlisp equivalent.
+func (ctx *Context) Bind(name string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Func {
+		fn, err := newGoFn(name, rv)
+		if err != nil {
+			return err
+		}
+		ctx.global.set(name, Value{typ: fnType, data: fn})
+		return nil
+	}
+
+	val, err := goToValue(rv, true)
+	if err != nil {
+		return err
+	}
+	ctx.global.set(name, val)
+	return nil
+}
+
+// newGoFn wraps the Go function f in a Fn.
+func newGoFn(name string, f reflect.Value) (*Fn, error) {
+	t := f.Type()
+	switch {
+	case t.NumOut() > 2:
+		return nil, fmt.Errorf("%s: too many results", name)
+	case t.NumOut() == 2 && t.Out(1) != errorType:
+		return nil, fmt.Errorf("%s: second result should be error", name)
+	}
+
+	minArgs := t.NumIn()
+	maxArgs := minArgs
+	if t.IsVariadic() {
+		minArgs--
+		maxArgs = -1
+	}
+
+	call := func(args ...Value) (Value, error) {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			rv, err := valueToGo(arg, paramType(t, i))
+			if err != nil {
+				return Value{}, newError(TypeError, arg.origin, "argument %d of %s: %v", i+1, name, err)
+			}
+			in[i] = rv
+		}
+		return goResults(f.Call(in))
+	}
+
+	sig := signature{name: name, minArgs: minArgs, maxArgs: maxArgs}
+	return &Fn{fn: call, sig: sig, host: true}, nil
+}
+
+// paramType returns the type of the i'th argument to a function of type t.
+func paramType(t reflect.Type, i int) reflect.Type {
+	if t.IsVariadic() && i >= t.NumIn()-1 {
+		return t.In(t.NumIn() - 1).Elem()
+	}
+	return t.In(i)
+}
+
+// goResults converts the results of a call to a Go function.
+func goResults(out []reflect.Value) (Value, error) {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		errVal := out[len(out)-1]
+		out = out[:len(out)-1]
+		if !errVal.IsNil() {
+			return Value{}, errVal.Interface().(error)
+		}
+	}
+	if len(out) == 0 {
+		return Value{typ: nilType}, nil
+	}
+	return goToValue(out[0], true)
+}
+
+// method implements the . form, which calls a method on an object.
+func method(env *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off . keyword
+
+	obj, err := eval(args[0], env)
+	if err != nil {
+		return Value{}, err
+	}
+	if obj.typ != objectType {
+		return Value{}, newError(TypeError, args[0].origin, "%v is not an object", args[0])
+	}
+
+	id := args[1]
+	if id.typ != idType {
+		return Value{}, newError(TypeError, id.origin, "method name should be Identifier, got %s", id.typ)
+	}
+	name := val2str(id)
+
+	m := val2obj(obj).MethodByName(name)
+	if !m.IsValid() {
+		return Value{}, newError(UnboundError, id.origin, "%s has no method %s", val2obj(obj).Type(), name)
+	}
+	fn, err := newGoFn(name, m)
+	if err != nil {
+		return Value{}, newError(TypeError, id.origin, "%s", err)
+	}
+
+	vals := make([]Value, len(args)-2)
+	for i, arg := range args[2:] {
+		vals[i], err = eval(arg, env)
+		if err != nil {
+			return Value{}, err
+		}
+	}
+	if err := validateFnArgs(fn, vals, id.origin); err != nil {
+		return Value{}, err
+	}
+	val, err := fn.fn(vals...)
+	if err != nil {
+		return val, wrapError(err, id.origin)
+	}
+	if err := env.ctx.allocResult(val, id.origin); err != nil {
+		return Value{}, err
+	}
+	return val, nil
+}
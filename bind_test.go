@@ -0,0 +1,88 @@
+package fatlisp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errFailed = errors.New("failed")
+
+type counter struct {
+	n int
+}
+
+func (c *counter) Add(n int) int {
+	c.n += n
+	return c.n
+}
+
+func (c counter) Value() int {
+	return c.n
+}
+
+func TestBindFunc(t *testing.T) {
+	ctx := NewContext()
+	ctx.Bind("join", strings.Join)
+	ctx.Bind("sum", func(xs ...float64) float64 {
+		var total float64
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	})
+	ctx.Bind("fail", func() (int, error) {
+		return 0, errFailed
+	})
+
+	v := evalString(t, ctx, `(join '("a" "b" "c") "-")`)
+	if s, _ := v.AsString(); s != "a-b-c" {
+		t.Errorf("expected a-b-c, got %v", v)
+	}
+
+	// Pointers to other types than structs are dereferenced.
+	ctx.Bind("answer", func() *int { n := 42; return &n })
+	v = evalString(t, ctx, `(answer)`)
+	if i, ok := v.AsInt(); !ok || i != 42 {
+		t.Errorf("expected 42, got %v", v)
+	}
+
+	v = evalString(t, ctx, `(sum 1 2.5 3)`)
+	if f, _ := v.AsFloat(); f != 6.5 {
+		t.Errorf("expected 6.5, got %v", v)
+	}
+
+	tree, _ := Parse("test", `(fail)`)
+	if _, err := ctx.Eval(tree); !errors.Is(err, errFailed) {
+		t.Errorf("expected error from fail, got %v", err)
+	}
+
+	tree, _ = Parse("test", `(join "a" "b")`)
+	if _, err := ctx.Eval(tree); err == nil {
+		t.Errorf("expected conversion error")
+	}
+}
+
+func TestBindObject(t *testing.T) {
+	ctx := NewContext()
+	c := &counter{}
+	if err := ctx.Bind("counter", c); err != nil {
+		t.Fatal(err)
+	}
+
+	evalString(t, ctx, `(. counter Add 40)`)
+	v := evalString(t, ctx, `(. counter Add 2)`)
+	if i, _ := v.AsInt(); i != 42 || c.n != 42 {
+		t.Errorf("expected 42, got %v", v)
+	}
+
+	v = evalString(t, ctx, `(. counter Value)`)
+	if i, _ := v.AsInt(); i != 42 {
+		t.Errorf("expected 42, got %v", v)
+	}
+
+	tree, _ := Parse("test", `(. counter Missing)`)
+	if _, err := ctx.Eval(tree); err == nil {
+		t.Errorf("expected error for missing method")
+	}
+}
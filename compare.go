@@ -1,37 +1,53 @@
 package fatlisp
 
-import "fmt"
-
 func equal(vals ...Value) (Value, error) {
 	x := vals[0]
 	y := vals[1]
+	return bool2val(x.equal(y)), nil
+}
 
+// equal reports whether x and y are equal. Numbers are equal if they
+// have the same value, even if one is an Int and the other a Float.
+// Lists are equal if their elements are. Fns, forms and objects are
+// only equal to themselves.
+func (x Value) equal(y Value) bool {
 	if x.typ != y.typ {
-		return int2val(-1), nil
+		if isNumeric(x) && isNumeric(y) {
+			return val2num(x).toFloat() == val2num(y).toFloat()
+		}
+		return false
 	}
 
-	var eq bool
 	switch x.typ {
 	case intType:
-		eq = val2int(x) == val2int(y)
+		return val2int(x) == val2int(y)
 	case floatType:
-		eq = val2float(x) == val2float(y)
-	case stringType:
-	case idType:
-		eq = val2str(x) == val2str(y)
+		return val2float(x) == val2float(y)
+	case stringType, idType:
+		return val2str(x) == val2str(y)
 	case listType:
-		return Value{}, fmt.Errorf("TODO: implement equals for lists")
+		xs, ys := val2slice(x), val2slice(y)
+		if len(xs) != len(ys) {
+			return false
+		}
+		for i := range xs {
+			if !xs[i].equal(ys[i]) {
+				return false
+			}
+		}
+		return true
 	case nilType:
-		eq = true
+		return true
 	case boolType:
-		eq = val2bool(x) == val2bool(y)
+		return val2bool(x) == val2bool(y)
 	case fnType:
-		xp := val2fn(x)
-		yp := val2fn(y)
-		eq = &xp == &yp
+		return val2fn(x) == val2fn(y)
+	case formType:
+		return val2form(x) == val2form(y)
+	case objectType:
+		return val2obj(x).Interface() == val2obj(y).Interface()
 	}
-
-	return bool2val(eq), nil
+	return false
 }
 
 func compare(vals ...Value) (Value, error) {
@@ -54,7 +70,7 @@ func (x Value) compare(y Value) (Value, error) {
 	case stringType:
 		return String(val2str(x)).compare(String(val2str(y))), nil
 	default:
-		return Value{}, newError(x.origin, "can't compare type %s", x.typ)
+		return Value{}, newError(TypeError, x.origin, "can't compare type %s", x.typ)
 	}
 }
 
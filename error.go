@@ -0,0 +1,154 @@
+package fatlisp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies the errors returned by the parser and evaluator.
+type ErrorKind int
+
+const (
+	LexError     ErrorKind = iota // malformed token
+	ParseError                    // malformed expression
+	TypeError                     // value of the wrong type
+	ArityError                    // wrong number of arguments
+	UnboundError                  // unresolved identifier
+	RuntimeError                  // any other error during evaluation
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case LexError:
+		return "LexError"
+	case ParseError:
+		return "ParseError"
+	case TypeError:
+		return "TypeError"
+	case ArityError:
+		return "ArityError"
+	case UnboundError:
+		return "UnboundError"
+	default:
+		return "RuntimeError"
+	}
+}
+
+// Pos is a position in source code.
+type Pos struct {
+	File   string
+	Line   int
+	Col    int
+	Offset int // byte offset in the source
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// Frame is a function call that was active when an error occurred.
+type Frame struct {
+	Name string // Name of the function
+	Pos  Pos    // Position of the call
+}
+
+// Error is the type of the errors returned by Parse and Eval.
+// Use errors.As to retrieve it.
+type Error struct {
+	Pos  Pos
+	End  Pos // End of the offending source, or equal to Pos if unknown.
+	Kind ErrorKind
+	Msg  string
+
+	// Frames lists the function calls that were active
+	// when the error occurred, innermost call first.
+	Frames []Frame
+
+	// Err is the underlying error, if any. For example the error
+	// returned by a Go function, or the error of a canceled
+	// context.Context.
+	Err error
+}
+
+// Error returns the position and message of the error. If the error
+// occurred inside a function call, they are preceded by a traceback
+// listing the active calls, most recent call last:
+//
+//	Traceback (most recent call last):
+//	  main.fl:9:1 in run
+//	  main.fl:5:3 in step
+//	main.fl:2:8 unexpected type String
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s", e.Pos, e.Msg)
+	if len(e.Frames) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString("Traceback (most recent call last):\n")
+	for i := len(e.Frames) - 1; i >= 0; i-- {
+		f := e.Frames[i]
+		fmt.Fprintf(&b, "  %s in %s\n", f.Pos, f.Name)
+
+		// Collapse recursive calls from the same call site.
+		repeated := 0
+		for i > 0 && e.Frames[i-1] == f {
+			repeated++
+			i--
+		}
+		if repeated > 0 {
+			fmt.Fprintf(&b, "  [previous line repeated %d more times]\n", repeated)
+		}
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+// Format returns the error followed by an excerpt of src, the source
+// of the file the error occurred in, with the offending code marked:
+//
+//	main.fl:2:4 unable to resolve foo
+//	  2 |   (foo 1)
+//	    |    ^~~
+func (e *Error) Format(src string) string {
+	lines := strings.Split(src, "\n")
+	if e.Pos.Line < 1 || e.Pos.Line > len(lines) {
+		return e.Error()
+	}
+	line := []rune(strings.TrimSuffix(lines[e.Pos.Line-1], "\r"))
+	start := e.Pos.Col - 1
+	if start < 0 || start > len(line) {
+		return e.Error()
+	}
+
+	end := len(line)
+	if e.End.Line == e.Pos.Line && e.End.Col > e.Pos.Col {
+		end = e.End.Col - 1
+	} else if e.End.Line <= e.Pos.Line {
+		end = start + 1
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+
+	// Keep tabs in the marker line, so it aligns with the source.
+	indent := append([]rune(nil), line[:start]...)
+	for i, r := range indent {
+		if r != '\t' {
+			indent[i] = ' '
+		}
+	}
+	marker := "^"
+	if end-start > 1 {
+		marker += strings.Repeat("~", end-start-1)
+	}
+
+	num := fmt.Sprint(e.Pos.Line)
+	gutter := strings.Repeat(" ", len(num))
+	return fmt.Sprintf("%s\n  %s | %s\n  %s | %s%s",
+		e.Error(), num, string(line), gutter, string(indent), marker)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -1,46 +1,136 @@
 package fatlisp
 
-import "fmt"
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sort"
+)
+
+// DefaultMaxDepth is the depth limit of a new Context. It keeps runaway
+// recursion and deeply nested forms from overflowing the Go stack.
+const DefaultMaxDepth = 10000
 
 type Context struct {
 	global *Env
+
+	// Limits on evaluation, to keep scripts from exhausting the host.
+	// Exceeding a limit stops evaluation with an error. Zero means no
+	// limit. Steps and allocations are counted per outermost call to Eval.
+	MaxDepth int // nested lists being evaluated, such as function calls
+	MaxSteps int // evaluated expressions
+	MaxAlloc int // elements of lists allocated during evaluation or returned by Go functions
+
+	// Streams used by the builtins that print and read.
+	// NewContext sets them to os.Stdout, os.Stderr and os.Stdin.
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+
+	// Buffers Stdin for read-line. in is the reader
+	// it was created for, to detect changes to Stdin.
+	stdin *bufio.Reader
+	in    io.Reader
+
+	depth int
+	steps int
+	alloc int
+
+	// Checked during evaluation to stop runaway scripts. Holds
+	// the context of every running call to EvalContext, which
+	// can be nested if a Go function calls Eval.
+	cancel []context.Context
 }
 
 type Env struct {
 	parent *Env
 	defs   map[string]Value
+	ctx    *Context
 }
 
 var defaults = map[string]Value{
-	"add":      newFn(add, 2, 2),
-	"subtract": newFn(subtract, 2, 2),
-	"multiply": newFn(multiply, 2, 2),
-	"divide":   newFn(divide, 2, 2),
-	"compare":  newFn(compare, 2, 2),
-	"puts":     newFn(puts, 0, -1),
+	"add":      newFn("add", add, 2, 2),
+	"subtract": newFn("subtract", subtract, 2, 2),
+	"multiply": newFn("multiply", multiply, 2, 2),
+	"divide":   newFn("divide", divide, 2, 2),
+	"compare":  newFn("compare", compare, 2, 2),
+	"equal":    newFn("equal", equal, 2, 2),
 	"def":      newForm("def", def, 2, 2, []Type{idType}),
-	"fn":       newForm("fn", fn, 2, 2, []Type{listType}),
-	"if":       newForm("if", _if, 2, 3, []Type{}),
+	"let":      newForm("let", let, 2, -1, []Type{listType}),
+	"let*":     newForm("let*", letStar, 2, -1, []Type{listType}),
+	"letrec":   newForm("letrec", letrec, 2, -1, []Type{listType}),
+	"fn":       newForm("fn", fn, 2, -1, []Type{listType}),
+	"if":       newForm("if", _if, 2, -1, []Type{}),
+	"do":       newForm("do", do, 0, -1, []Type{}),
+	"when":     newForm("when", when, 1, -1, []Type{}),
+	"unless":   newForm("unless", unless, 1, -1, []Type{}),
+	"cond":     newForm("cond", cond, 0, -1, []Type{}),
+	"case":     newForm("case", _case, 1, -1, []Type{}),
+	"and":      newForm("and", and, 0, -1, []Type{}),
+	"or":       newForm("or", or, 0, -1, []Type{}),
 	"quote":    newForm("quote", quote, 1, 1, []Type{}),
+	".":        newForm(".", method, 2, -1, []Type{}),
 }
 
 func NewContext() *Context {
-	global := newEnvWithDefs(defaults)
-	return &Context{global}
+	ctx := &Context{
+		global:   newEnvWithDefs(defaults),
+		MaxDepth: DefaultMaxDepth,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Stdin:    os.Stdin,
+	}
+	ctx.global.ctx = ctx
+	ctx.defineIO()
+	return ctx
+}
+
+// Define makes the Go function fn available in the global scope of the
+// context under name. fn is called with its arguments already evaluated.
+// maxArgs is -1 if fn accepts any number of arguments.
+func (ctx *Context) Define(name string, fn func(args ...Value) (Value, error), minArgs, maxArgs int) {
+	v := newFn(name, fn, minArgs, maxArgs)
+	val2fn(v).host = true
+	ctx.global.set(name, v)
+}
+
+// DefineForm makes fn available as a special form under name. Unlike
+// functions registered with Define, a form receives its arguments
+// unevaluated, together with the Env it was called from. Use Env.Eval
+// to evaluate arguments where needed.
+func (ctx *Context) DefineForm(name string, fn func(env *Env, args ...Value) (Value, error), minArgs, maxArgs int) {
+	form := func(env *Env, args ...Value) (Value, error) {
+		return fn(env, args[1:]...) // Pop off form keyword
+	}
+	ctx.global.set(name, newForm(name, form, minArgs, maxArgs, []Type{}))
 }
 
 func newEnv() *Env {
 	return &Env{defs: make(map[string]Value, 1)}
 }
 
+// Construct a new env containing a copy of defs, so definitions
+// made in one context don't leak into the defaults of another.
 func newEnvWithDefs(defs map[string]Value) *Env {
-	return &Env{defs: defs}
+	env := newEnv()
+	for name, v := range defs {
+		env.set(name, v)
+	}
+	return env
 }
 
-// Construct a new function scope based on parent scope.
-func newFunctionEnv(parent *Env, params Value, args []Value) *Env {
+// Construct a new scope nested in parent.
+func newChildEnv(parent *Env) *Env {
 	env := newEnv()
 	env.parent = parent
+	env.ctx = parent.ctx
+	return env
+}
+
+// Construct a new function scope based on parent scope.
+func newFunctionEnv(parent *Env, params Value, args []Value) *Env {
+	env := newChildEnv(parent)
 
 	for i, p := range val2slice(params) {
 		name := val2str(p)
@@ -62,14 +152,58 @@ func (e Env) get(val Value) (Value, error) {
 			parent := *e.parent
 			return parent.get(val)
 		} else {
-			err := newError(val.origin, "unable to resolve %s", id)
+			err := newError(UnboundError, val.origin, "unable to resolve %s", id)
 			return Value{}, err
 		}
 	}
 	return v, nil
 }
 
+// Names returns the sorted names bound in e and its parent scopes.
+func (e *Env) Names() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for env := e; env != nil; env = env.parent {
+		for name := range env.defs {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Names returns the sorted names bound in the global scope of the context.
+func (ctx *Context) Names() []string {
+	return ctx.global.Names()
+}
+
+// Eval evaluates v in the scope of e.
+func (e *Env) Eval(v Value) (Value, error) {
+	return eval(v, e)
+}
+
 func (ctx *Context) Eval(root Value) ([]Value, error) {
+	return ctx.EvalContext(context.Background(), root)
+}
+
+// EvalContext is like Eval, but stops evaluation when c is canceled or
+// its deadline passes. The returned error then wraps c.Err(), so it can
+// be detected with errors.Is(err, context.DeadlineExceeded) or
+// errors.Is(err, context.Canceled).
+//
+// A Go function called during evaluation can call Eval or EvalContext
+// on the same Context. The nested evaluation counts towards the limits
+// of the outer one, and stops when the context of either is done.
+func (ctx *Context) EvalContext(c context.Context, root Value) ([]Value, error) {
+	if len(ctx.cancel) == 0 {
+		ctx.depth, ctx.steps, ctx.alloc = 0, 0, 0
+	}
+	ctx.cancel = append(ctx.cancel, c)
+	defer func() { ctx.cancel = ctx.cancel[:len(ctx.cancel)-1] }()
+
 	results := []Value{}
 	for _, v := range val2slice(root) {
 		res, err := eval(v, ctx.global)
@@ -82,15 +216,122 @@ func (ctx *Context) Eval(root Value) ([]Value, error) {
 	return results, nil
 }
 
+// checkCanceled returns an error if the evaluation
+// running in ctx should be stopped.
+func (ctx *Context) checkCanceled(v Value) error {
+	if ctx == nil {
+		return nil
+	}
+	for _, c := range ctx.cancel {
+		select {
+		case <-c.Done():
+			err := c.Err()
+			msg := "evaluation stopped: " + err.Error()
+			return &Error{Pos: v.origin.pos, End: v.origin.end, Kind: RuntimeError, Msg: msg, Err: err}
+		default:
+		}
+	}
+	return nil
+}
+
+// step counts an evaluation step, returning an error
+// if the step limit is exceeded.
+func (ctx *Context) step(v Value) error {
+	if ctx == nil {
+		return nil
+	}
+	ctx.steps++
+	if ctx.MaxSteps > 0 && ctx.steps > ctx.MaxSteps {
+		return newError(RuntimeError, v.origin, "step limit of %d exceeded", ctx.MaxSteps)
+	}
+	return nil
+}
+
+// enter records the evaluation of a list, returning an
+// error if the depth limit is exceeded. Every successful
+// call to enter must be followed by a call to leave.
+func (ctx *Context) enter(list Value) error {
+	if ctx == nil {
+		return nil
+	}
+	if ctx.MaxDepth > 0 && ctx.depth >= ctx.MaxDepth {
+		return newError(RuntimeError, list.origin, "depth limit of %d exceeded", ctx.MaxDepth)
+	}
+	ctx.depth++
+	return nil
+}
+
+func (ctx *Context) leave() {
+	if ctx != nil {
+		ctx.depth--
+	}
+}
+
+// allocList counts the allocation of a list of n elements,
+// returning an error if the allocation limit is exceeded.
+func (ctx *Context) allocList(n int, origin item) error {
+	if ctx == nil {
+		return nil
+	}
+	ctx.alloc += n
+	if ctx.MaxAlloc > 0 && ctx.alloc > ctx.MaxAlloc {
+		return newError(RuntimeError, origin, "allocation limit of %d exceeded", ctx.MaxAlloc)
+	}
+	return nil
+}
+
+// allocResult counts the lists in v, a value returned by a
+// Go function, returning an error if the allocation limit is
+// exceeded.
+func (ctx *Context) allocResult(v Value, origin item) error {
+	if v.typ != listType {
+		return nil
+	}
+	vals := val2slice(v)
+	if err := ctx.allocList(len(vals), origin); err != nil {
+		return err
+	}
+	for _, val := range vals {
+		if err := ctx.allocResult(val, origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func eval(v Value, e *Env) (Value, error) {
+	if err := e.ctx.checkCanceled(v); err != nil {
+		return Value{}, err
+	}
+	if err := e.ctx.step(v); err != nil {
+		return Value{}, err
+	}
+
+	var val Value
+	var err error
 	switch v.typ {
 	case idType:
-		return e.get(v)
+		val, err = e.get(v)
 	case listType:
-		return evalList(v, e)
+		// Every list counts towards the depth limit, so deeply
+		// nested forms can't overflow the Go stack either.
+		if err := e.ctx.enter(v); err != nil {
+			return Value{}, err
+		}
+		val, err = evalList(v, e)
+		e.ctx.leave()
 	default:
 		return v, nil
 	}
+	if err != nil {
+		return Value{}, err
+	}
+
+	// Errors about the result should point to the
+	// expression it came from, not to where it was
+	// defined or to nowhere for values made by Go.
+	val.origin = v.origin
+	return val, nil
 }
 
 func evalList(list Value, env *Env) (Value, error) {
@@ -108,6 +349,10 @@ func evalList(list Value, env *Env) (Value, error) {
 	// Returning an error if neither.
 	switch first.typ {
 	case fnType:
+		if err := env.ctx.allocList(len(args), list.origin); err != nil {
+			return Value{}, err
+		}
+
 		// Loop over the rest of the list and eval each of
 		// the function's arguments.
 		for i, c := range slice[1:] {
@@ -120,24 +365,28 @@ func evalList(list Value, env *Env) (Value, error) {
 		}
 
 		fn := val2fn(first)
-		if err := validateFnArgs(fn, args); err != nil {
-			err := newError(id.origin, err.Error())
+		if err := validateFnArgs(fn, args, id.origin); err != nil {
 			return Value{}, err
 		}
 		val, err := fn.fn(args...)
 		if err != nil {
-			return val, err
+			err = wrapError(err, list.origin)
+			return val, addFrame(err, fn.sig.name, list.origin)
+		}
+		if fn.host {
+			if err := env.ctx.allocResult(val, list.origin); err != nil {
+				return Value{}, err
+			}
 		}
 		return val, err
 	case formType:
 		form := val2form(first)
-		if err := validateFormArgs(form, slice[1:]); err != nil {
-			err := newError(id.origin, err.Error())
+		if err := validateFormArgs(form, slice[1:], id.origin); err != nil {
 			return Value{}, err
 		}
 		return form.fn(env, slice...)
 	default:
-		err := newError(first.origin, "not a function: %v", slice[0])
+		err := newError(TypeError, first.origin, "not a function: %v", slice[0])
 		return Value{}, err
 	}
 }
@@ -146,16 +395,20 @@ func quote(e *Env, vals ...Value) (Value, error) {
 	return vals[1], nil
 }
 
+// fn creates a function. The body can have several expressions,
+// which are evaluated in order when the function is called:
+//
+//	(fn (x) (puts x) (add x 1))
 func fn(e *Env, vals ...Value) (Value, error) {
 	vals = vals[1:] // Pop off fn keyword
 
 	params := vals[0]
-	body := vals[1]
+	body := vals[1:]
 
 	min := len(val2slice(params))
 	max := min
-	fn := newFn(func(args ...Value) (Value, error) {
-		res, err := eval(body, newFunctionEnv(e, params, args))
+	fn := newFn("fn", func(args ...Value) (Value, error) {
+		res, err := evalBody(body, newFunctionEnv(e, params, args))
 		if err != nil {
 			return Value{}, err
 		}
@@ -175,17 +428,113 @@ func def(e *Env, args ...Value) (Value, error) {
 		return Value{}, err
 	}
 
-	// if value is a fn, set the name on its signature
-	// so it can be displayed in error messages
-	if val.typ == fnType {
-		fn := val2fn(val)
-		fn.sig.name = id
-	}
-
+	nameFn(val, args[1], id)
 	e.set(id, val)
 	return args[0], nil
 }
 
+// nameFn sets name on the signature of val, so it can be displayed
+// in error messages, if val is the fn created by the fn literal expr.
+// Other fns keep their name: they can be bound to several names, and
+// builtins are shared by all contexts.
+func nameFn(val, expr Value, name string) {
+	if val.typ != fnType || expr.typ != listType {
+		return
+	}
+	vals := val2slice(expr)
+	if len(vals) > 0 && vals[0].typ == idType && val2str(vals[0]) == "fn" {
+		val2fn(val).sig.name = name
+	}
+}
+
+// let binds names to values in a new scope, and evaluates its body there:
+//
+//	(let ((x 1) (y 2)) (add x y))
+//
+// The values are evaluated in the enclosing scope, so they
+// can't refer to each other.
+func let(e *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off let keyword
+
+	names, exprs, err := bindings("let", args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	env := newChildEnv(e)
+	for i, name := range names {
+		val, err := eval(exprs[i], e)
+		if err != nil {
+			return Value{}, err
+		}
+		nameFn(val, exprs[i], name)
+		env.set(name, val)
+	}
+	return evalBody(args[1:], env)
+}
+
+// letStar is like let, but binds the names one after another, each
+// in its own scope, so a value can refer to the names before it.
+func letStar(e *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off let* keyword
+
+	names, exprs, err := bindings("let*", args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	env := e
+	for i, name := range names {
+		val, err := eval(exprs[i], env)
+		if err != nil {
+			return Value{}, err
+		}
+		nameFn(val, exprs[i], name)
+		env = newChildEnv(env)
+		env.set(name, val)
+	}
+	return evalBody(args[1:], env)
+}
+
+// letrec is like let*, but binds all names in a single scope, in
+// which the values are evaluated. Functions bound by letrec can
+// call each other, and themselves.
+func letrec(e *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off letrec keyword
+
+	names, exprs, err := bindings("letrec", args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	env := newChildEnv(e)
+	for i, name := range names {
+		val, err := eval(exprs[i], env)
+		if err != nil {
+			return Value{}, err
+		}
+		nameFn(val, exprs[i], name)
+		env.set(name, val)
+	}
+	return evalBody(args[1:], env)
+}
+
+// bindings checks that list is a list of (name value) bindings,
+// and returns the names and the expressions for their values.
+func bindings(form string, list Value) ([]string, []Value, error) {
+	vals := val2slice(list)
+	names := make([]string, len(vals))
+	exprs := make([]Value, len(vals))
+	for i, b := range vals {
+		if b.typ != listType || len(val2slice(b)) != 2 || b.get(0).typ != idType {
+			return nil, nil, newError(TypeError, b.origin, "binding %d of %s should be (Identifier value), got %v",
+				i+1, form, b)
+		}
+		names[i] = val2str(b.get(0))
+		exprs[i] = b.get(1)
+	}
+	return names, exprs, nil
+}
+
+// _if evaluates its second argument if the first one is truthy.
+// Otherwise it evaluates the remaining arguments in order, like do.
 func _if(env *Env, args ...Value) (Value, error) {
 	var val Value
 	var err error
@@ -198,8 +547,8 @@ func _if(env *Env, args ...Value) (Value, error) {
 
 	if truthy(val) {
 		val, err = eval(args[1], env)
-	} else if len(args) > 2 {
-		val, err = eval(args[2], env)
+	} else {
+		val, err = evalBody(args[2:], env)
 	}
 	if err != nil {
 		return Value{}, err
@@ -207,6 +556,180 @@ func _if(env *Env, args ...Value) (Value, error) {
 	return val, nil
 }
 
+// do evaluates its arguments in order, and returns the last result:
+//
+//	(do (puts "adding") (add 1 2))
+func do(env *Env, args ...Value) (Value, error) {
+	return evalBody(args[1:], env)
+}
+
+// when evaluates its body if the first argument is truthy,
+// and returns nil otherwise:
+//
+//	(when (equal x 0) (puts "zero") x)
+func when(env *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off when keyword
+
+	test, err := eval(args[0], env)
+	if err != nil {
+		return Value{}, err
+	}
+	if !truthy(test) {
+		return Value{typ: nilType}, nil
+	}
+	return evalBody(args[1:], env)
+}
+
+// unless is like when, but evaluates its body
+// if the first argument is not truthy.
+func unless(env *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off unless keyword
+
+	test, err := eval(args[0], env)
+	if err != nil {
+		return Value{}, err
+	}
+	if truthy(test) {
+		return Value{typ: nilType}, nil
+	}
+	return evalBody(args[1:], env)
+}
+
+// cond evaluates the body of the first clause whose test is truthy.
+// A clause with the test else always matches. A clause without a body
+// returns the value of its test. If no clause matches, cond returns nil:
+//
+//	(cond ((equal x 0) "zero")
+//	      ((equal x 1) "one")
+//	      (else "many"))
+func cond(env *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off cond keyword
+
+	if err := checkClauses("cond", args); err != nil {
+		return Value{}, err
+	}
+	for _, clause := range args {
+		vals := val2slice(clause)
+		if isElse(vals[0]) {
+			return evalBody(vals[1:], env)
+		}
+		test, err := eval(vals[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+		if !truthy(test) {
+			continue
+		}
+		if len(vals) == 1 {
+			return test, nil
+		}
+		return evalBody(vals[1:], env)
+	}
+	return Value{typ: nilType}, nil
+}
+
+// _case evaluates the first argument, and then the body of the first
+// clause that lists a value equal to it. The values in a clause aren't
+// evaluated. They are either a list of alternatives, or a single value
+// that isn't a list. A clause starting with else always matches. If no
+// clause matches, case returns nil:
+//
+//	(case x
+//	      ((1 2 3) "small")
+//	      ("many" "many")
+//	      (else "large"))
+func _case(env *Env, args ...Value) (Value, error) {
+	args = args[1:] // Pop off case keyword
+
+	key, err := eval(args[0], env)
+	if err != nil {
+		return Value{}, err
+	}
+	if err := checkClauses("case", args[1:]); err != nil {
+		return Value{}, err
+	}
+	for _, clause := range args[1:] {
+		vals := val2slice(clause)
+		if isElse(vals[0]) {
+			return evalBody(vals[1:], env)
+		}
+		alts := []Value{vals[0]}
+		if vals[0].typ == listType {
+			alts = val2slice(vals[0])
+		}
+		for _, alt := range alts {
+			if key.equal(alt) {
+				return evalBody(vals[1:], env)
+			}
+		}
+	}
+	return Value{typ: nilType}, nil
+}
+
+// and evaluates its arguments in order until one isn't truthy, and
+// returns the last value it evaluated. It returns true if there are
+// no arguments.
+func and(env *Env, args ...Value) (Value, error) {
+	val := bool2val(true)
+	for _, arg := range args[1:] {
+		var err error
+		if val, err = eval(arg, env); err != nil {
+			return Value{}, err
+		}
+		if !truthy(val) {
+			break
+		}
+	}
+	return val, nil
+}
+
+// or evaluates its arguments in order until one is truthy, and
+// returns the last value it evaluated. It returns false if there
+// are no arguments.
+func or(env *Env, args ...Value) (Value, error) {
+	val := bool2val(false)
+	for _, arg := range args[1:] {
+		var err error
+		if val, err = eval(arg, env); err != nil {
+			return Value{}, err
+		}
+		if truthy(val) {
+			break
+		}
+	}
+	return val, nil
+}
+
+// checkClauses returns an error if one of the clauses
+// of a cond or case form isn't a non-empty list.
+func checkClauses(form string, clauses []Value) error {
+	for i, clause := range clauses {
+		if clause.typ != listType || len(val2slice(clause)) == 0 {
+			return newError(TypeError, clause.origin, "clause %d of %s should be a non-empty List, got %v",
+				i+1, form, clause)
+		}
+	}
+	return nil
+}
+
+// isElse reports whether v is the else keyword of a cond or case clause.
+func isElse(v Value) bool {
+	return v.typ == idType && val2str(v) == "else"
+}
+
+// evalBody evaluates the expressions in body in order, and returns
+// the result of the last one. It returns nil if body is empty.
+func evalBody(body []Value, env *Env) (Value, error) {
+	val := Value{typ: nilType}
+	for _, expr := range body {
+		var err error
+		if val, err = eval(expr, env); err != nil {
+			return Value{}, err
+		}
+	}
+	return val, nil
+}
+
 func truthy(v Value) bool {
 	if v.typ == nilType {
 		return false
@@ -218,47 +741,38 @@ func truthy(v Value) bool {
 	return true
 }
 
-func puts(vals ...Value) (Value, error) {
-	for _, v := range vals {
-		fmt.Print(v)
-		fmt.Print(" ")
-	}
-	fmt.Print("\n")
-	return Value{typ: nilType}, nil
-}
-
-func validateFnArgs(fn *Fn, args []Value) error {
-	if err := validateArgCount(fn.sig, args); err != nil {
+func validateFnArgs(fn *Fn, args []Value, origin item) error {
+	if err := validateArgCount(fn.sig, args, origin); err != nil {
 		return err
 	}
 	return nil
 }
 
-func validateFormArgs(form *specialForm, args []Value) error {
-	if err := validateArgCount(form.sig, args); err != nil {
+func validateFormArgs(form *specialForm, args []Value, origin item) error {
+	if err := validateArgCount(form.sig, args, origin); err != nil {
 		return err
 	}
-	if err := validateArgTypes(form.sig, args); err != nil {
+	if err := validateArgTypes(form.sig, args, origin); err != nil {
 		return err
 	}
 	return nil
 }
 
-func validateArgCount(sig signature, args []Value) error {
+func validateArgCount(sig signature, args []Value, origin item) error {
 	argc := len(args)
 	if argc < sig.minArgs {
-		return argCountError(sig.name, sig.minArgs, argc)
+		return argCountError(sig.name, sig.minArgs, argc, origin)
 	}
 	if sig.maxArgs != -1 && argc > sig.maxArgs {
-		return argCountError(sig.name, sig.maxArgs, argc)
+		return argCountError(sig.name, sig.maxArgs, argc, origin)
 	}
 	return nil
 }
 
-func validateArgTypes(sig signature, args []Value) error {
+func validateArgTypes(sig signature, args []Value, origin item) error {
 	for i, typ := range sig.types {
 		if typ != args[i].typ {
-			err := fmt.Errorf("argument %d of %s should be %s, got %s",
+			err := newError(TypeError, origin, "argument %d of %s should be %s, got %s",
 				i+1, sig.name, typ, args[i].typ)
 			return err
 		}
@@ -266,12 +780,12 @@ func validateArgTypes(sig signature, args []Value) error {
 	return nil
 }
 
-func argCountError(name string, expected, actual int) error {
+func argCountError(name string, expected, actual int, origin item) error {
 	arguments := "argument"
 	if expected != 1 {
 		arguments += "s"
 	}
 
-	return fmt.Errorf("%s expected %d %s, got %d",
+	return newError(ArityError, origin, "%s expected %d %s, got %d",
 		name, expected, arguments, actual)
 }
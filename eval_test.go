@@ -0,0 +1,408 @@
+package fatlisp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func evalString(t *testing.T, ctx *Context, src string) Value {
+	tree, err := Parse("test", src)
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	results, err := ctx.Eval(tree)
+	if err != nil {
+		t.Fatalf("eval %q: %v", src, err)
+	}
+	return results[len(results)-1]
+}
+
+func TestDefine(t *testing.T) {
+	ctx := NewContext()
+	ctx.Define("double", func(args ...Value) (Value, error) {
+		return multiply(args[0], int2val(2))
+	}, 1, 1)
+
+	v := evalString(t, ctx, "(double 21)")
+	if v.typ != intType || val2int(v) != 42 {
+		t.Errorf("expected 42, got %v", v)
+	}
+
+	tree, _ := Parse("test", "(double 1 2)")
+	if _, err := ctx.Eval(tree); err == nil {
+		t.Errorf("expected arity error")
+	}
+
+	if _, err := NewContext().Eval(tree); err == nil {
+		t.Errorf("definition leaked into another context")
+	}
+}
+
+func TestDefineForm(t *testing.T) {
+	ctx := NewContext()
+	ctx.DefineForm("second", func(env *Env, args ...Value) (Value, error) {
+		return env.Eval(args[1])
+	}, 2, 2)
+
+	v := evalString(t, ctx, "(second undefined (add 1 2))")
+	if v.typ != intType || val2int(v) != 3 {
+		t.Errorf("expected 3, got %v", v)
+	}
+}
+
+func TestLet(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"(let ((x 1) (y 2)) (add x y))", "3"},
+		{"(let () 1)", "1"},
+		{"(def x 1) (let ((x 2) (y x)) y)", "1"},
+		{"(let* ((x 1) (y (add x 1))) y)", "2"},
+		{"(let* ((x 1) (x (add x 1))) x)", "2"},
+		{"(letrec ((f (fn (n) (g n))) (g (fn (n) (add n 1)))) (f 1))", "2"},
+	}
+
+	for _, test := range tests {
+		v := evalString(t, NewContext(), test.src)
+		if v.String() != test.expected {
+			t.Errorf("%s: expected %s, got %v", test.src, test.expected, v)
+		}
+	}
+
+	errs := []struct {
+		src string
+		msg string
+	}{
+		{"(let x 1)", "argument 1 of let should be List, got Identifier"},
+		{"(let ((x 1) y) x)", "binding 2 of let should be (Identifier value), got y"},
+		{"(let* ((1 2)) 3)", "binding 1 of let* should be (Identifier value), got (1 2)"},
+		{"(let ((x 1) (y x)) y)", "unable to resolve x"},
+		{"(let* ((f (fn () (g))) (g (fn () 1))) (f))", "unable to resolve g"},
+	}
+
+	for _, test := range errs {
+		tree, _ := Parse("test", test.src)
+		_, err := NewContext().Eval(tree)
+		var e *Error
+		if !errors.As(err, &e) || e.Msg != test.msg {
+			t.Errorf("%s: expected error %q, got %v", test.src, test.msg, err)
+		}
+	}
+}
+
+func TestBody(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+		out      string
+	}{
+		{"(do)", "nil", ""},
+		{`(do (puts "a") (puts "b") 3)`, "3", "a \nb \n"},
+		{`((fn (x) (puts "called") (add x 1)) 1)`, "2", "called \n"},
+		{`(let ((x 1)) (def y 2) (add x y))`, "3", ""},
+		{`(if true 1 (puts "else") 2)`, "1", ""},
+		{`(if false 1 (puts "else") 2)`, "2", "else \n"},
+	}
+
+	for _, test := range tests {
+		ctx := NewContext()
+		var out bytes.Buffer
+		ctx.Stdout = &out
+		v := evalString(t, ctx, test.src)
+		if v.String() != test.expected || out.String() != test.out {
+			t.Errorf("%s: expected %s with output %q, got %v with output %q",
+				test.src, test.expected, test.out, v, out.String())
+		}
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+		out      string
+	}{
+		{`(when true (puts "a") 1)`, "1", "a \n"},
+		{`(when nil (puts "a") 1)`, "nil", ""},
+		{`(unless false (puts "a") 1)`, "1", "a \n"},
+		{`(unless 0 (puts "a") 1)`, "nil", ""},
+		{`(cond)`, "nil", ""},
+		{`(cond (false 1) (nil 2) (true (puts "a") 3))`, "3", "a \n"},
+		{`(cond (false 1) (else 2))`, "2", ""},
+		{`(cond ((add 1 1)))`, "2", ""},
+		{`(cond (false 1))`, "nil", ""},
+		{`(case (add 1 1) ((1 3) "odd") ((2 4) "even"))`, "even", ""},
+		{`(case "b" ("a" 1) ("b" 2))`, "2", ""},
+		{`(case 2.0 ((1 2) "int"))`, "int", ""},
+		{`(case '(1 "a") (((1 "a")) "list"))`, "list", ""},
+		{`(case x (1 "one") (else "other"))`, "other", ""},
+		{`(case 5 ((1 2) "small"))`, "nil", ""},
+		{`(and)`, "true", ""},
+		{`(and 1 2)`, "2", ""},
+		{`(and 1 false (puts "a"))`, "false", ""},
+		{`(or)`, "false", ""},
+		{`(or nil 2 (puts "a"))`, "2", ""},
+		{`(or nil false)`, "false", ""},
+		{`(equal '(1 (2 "a")) '(1 (2 "a")))`, "true", ""},
+		{`(equal "a" "b")`, "false", ""},
+		{`(equal add add)`, "true", ""},
+		{`(equal add subtract)`, "false", ""},
+	}
+
+	for _, test := range tests {
+		ctx := NewContext()
+		ctx.Define("x", func(args ...Value) (Value, error) { return args[0], nil }, 1, 1)
+		var out bytes.Buffer
+		ctx.Stdout = &out
+		v := evalString(t, ctx, test.src)
+		if v.String() != test.expected || out.String() != test.out {
+			t.Errorf("%s: expected %s with output %q, got %v with output %q",
+				test.src, test.expected, test.out, v, out.String())
+		}
+	}
+
+	tree, _ := Parse("test", "(cond (true 1) 2)")
+	_, err := NewContext().Eval(tree)
+	var e *Error
+	msg := "clause 2 of cond should be a non-empty List, got 2"
+	if !errors.As(err, &e) || e.Msg != msg {
+		t.Errorf("expected error %q, got %v", msg, err)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	ctx := NewContext()
+	ctx.Define("sleep", func(args ...Value) (Value, error) {
+		time.Sleep(20 * time.Millisecond)
+		return NilValue(), nil
+	}, 0, 0)
+	tree, _ := Parse("test", "(sleep) (sleep) (sleep)")
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ctx.EvalContext(c, tree); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	c, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	results, err := ctx.EvalContext(c, tree)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected 1 result before the deadline, got %d", len(results))
+	}
+
+	if _, err := ctx.Eval(tree); err != nil {
+		t.Errorf("unexpected error after EvalContext: %v", err)
+	}
+	// An Eval nested in a Go function keeps the outer deadline.
+	ctx.Define("nested", func(args ...Value) (Value, error) {
+		tree, _ := Parse("nested", "(add 1 2)")
+		_, err := ctx.Eval(tree)
+		return NilValue(), err
+	}, 0, 0)
+	tree, _ = Parse("test", "(nested) (sleep) (add 1 2) (add 3 4)")
+	c, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	results, err = ctx.EvalContext(c, tree)
+	if !errors.Is(err, context.DeadlineExceeded) || len(results) != 2 {
+		t.Errorf("expected context.DeadlineExceeded after 2 results, got %d results and %v", len(results), err)
+	}
+
+	// And doesn't reset the counters of the outer evaluation.
+	ctx.MaxSteps = 8
+	tree, _ = Parse("test", "(nested) (nested) (nested)")
+	if _, err := ctx.Eval(tree); err == nil {
+		t.Errorf("expected step limit error with nested Eval")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		src   string
+		setup func(ctx *Context)
+		msg   string
+		pos   Pos
+	}{
+		{"(def loop (fn (x) (loop x))) (loop 1)", func(ctx *Context) {},
+			"depth limit of 10000 exceeded", Pos{"test", 1, 19, 18}},
+		{"(add 1 (add 2 (add 3 4)))", func(ctx *Context) { ctx.MaxSteps = 5 },
+			"step limit of 5 exceeded", Pos{"test", 1, 13, 12}},
+		{"(puts 1 2 3) (puts 4 5 6)", func(ctx *Context) { ctx.MaxAlloc = 5 },
+			"allocation limit of 5 exceeded", Pos{"test", 1, 14, 13}},
+		{"(ints 10) (ints 100)", func(ctx *Context) { ctx.MaxAlloc = 100 },
+			"allocation limit of 100 exceeded", Pos{"test", 1, 11, 10}},
+		{"(config) (config)", func(ctx *Context) { ctx.MaxAlloc = 10 },
+			"allocation limit of 10 exceeded", Pos{"test", 1, 10, 9}},
+		{strings.Repeat("(do ", 100000) + "1" + strings.Repeat(")", 100000), func(ctx *Context) {},
+			"depth limit of 10000 exceeded", Pos{"test", 1, 40001, 40000}},
+	}
+
+	for _, test := range tests {
+		ctx := NewContext()
+		ctx.Stdout = &bytes.Buffer{}
+		ctx.Bind("ints", func(n int) []int { return make([]int, n) })
+		ctx.Define("config", func(args ...Value) (Value, error) {
+			return Marshal(map[string][]int{"a": {1, 2}, "b": {3, 4}})
+		}, 0, 0)
+		test.setup(ctx)
+		tree, err := Parse("test", test.src)
+		if err != nil {
+			t.Fatalf("%.40s: %v", test.src, err)
+		}
+		_, err = ctx.Eval(tree)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%.40s: expected *Error, got %v", test.src, err)
+			continue
+		}
+		if e.Kind != RuntimeError || e.Msg != test.msg || e.Pos != test.pos {
+			t.Errorf("%.40s: expected %s %q at %s, got %s %q at %s",
+				test.src, RuntimeError, test.msg, test.pos, e.Kind, e.Msg, e.Pos)
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	ctx := NewContext()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	ctx.Stdout = stdout
+	ctx.Stderr = stderr
+	ctx.Stdin = strings.NewReader("first\nsecond")
+
+	evalString(t, ctx, `(puts (read-line) 1) (eputs (read-line)) (puts (read-line))`)
+
+	if s := stdout.String(); s != "first 1 \nnil \n" {
+		t.Errorf("unexpected stdout %q", s)
+	}
+	if s := stderr.String(); s != "second \n" {
+		t.Errorf("unexpected stderr %q", s)
+	}
+	// Readers of types that can't be compared with == work too.
+	ctx.Stdin = uncomparableReader{strings.NewReader("third\nfourth"), nil}
+	stdout.Reset()
+	evalString(t, ctx, `(puts (read-line) (read-line))`)
+	if s := stdout.String(); s != "third fourth \n" {
+		t.Errorf("unexpected stdout %q", s)
+	}
+
+	ctx.Stdout = failingWriter{}
+	tree, _ := Parse("test", `(puts 1 2)`)
+	if _, err := ctx.Eval(tree); !errors.Is(err, errFailed) {
+		t.Errorf("expected write error, got %v", err)
+	}
+}
+
+type uncomparableReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (u uncomparableReader) Read(p []byte) (int, error) {
+	return u.r.Read(p)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errFailed
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		src  string
+		kind ErrorKind
+		pos  Pos
+	}{
+		{`(add 1 "2")`, TypeError, Pos{"test", 1, 8, 7}},
+		{`(add 1)`, ArityError, Pos{"test", 1, 2, 1}},
+		{"\n  (foo)", UnboundError, Pos{"test", 2, 4, 4}},
+		{`(def 1 2)`, TypeError, Pos{"test", 1, 2, 1}},
+		{`(add 1 nil)`, TypeError, Pos{"test", 1, 8, 7}},
+		{"(def s \"a\")\n(add s 1)", TypeError, Pos{"test", 2, 6, 17}},
+		{`(add (quote x) 1)`, TypeError, Pos{"test", 1, 6, 5}},
+	}
+
+	for _, test := range tests {
+		tree, _ := Parse("test", test.src)
+		_, err := NewContext().Eval(tree)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: expected *Error, got %v", test.src, err)
+			continue
+		}
+		if e.Kind != test.kind || e.Pos != test.pos {
+			t.Errorf("%s: expected %s at %s, got %s at %s",
+				test.src, test.kind, test.pos, e.Kind, e.Pos)
+		}
+	}
+
+	_, err := Parse("test", `"unclosed`)
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != LexError {
+		t.Errorf("expected LexError, got %v", err)
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	src := `(def inner (fn (x) (add x "1")))
+(def outer (fn (x) (inner x)))
+ (outer 1)`
+	tree, _ := Parse("test", src)
+	_, err := NewContext().Eval(tree)
+
+	expected := `Traceback (most recent call last):
+  test:3:2 in outer
+  test:2:20 in inner
+  test:1:20 in add
+test:1:27 unexpected type String`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected traceback\n%s\ngot\n%v", expected, err)
+	}
+
+	// Binding an existing fn to another name doesn't rename it,
+	// in this context or in the shared builtins of others.
+	tests := []struct {
+		src   string
+		frame string
+	}{
+		{"(def f (fn (x) (add x \"a\"))) (def g f) (f 1)", "in f"},
+		{"(def f (fn (x) (add x \"a\"))) (let ((g f)) (g 1))", "in f"},
+		{"(let ((plus add)) (plus 1 \"a\"))", "in add"},
+		{"(add 1 \"a\")", "in add"},
+	}
+	ctx := NewContext()
+	for _, test := range tests {
+		tree, _ := Parse("test", test.src)
+		_, err := ctx.Eval(tree)
+		if err == nil || !strings.Contains(err.Error(), test.frame) {
+			t.Errorf("%s: expected traceback %s, got\n%v", test.src, test.frame, err)
+		}
+		ctx = NewContext()
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	src := "(def x 1)\n\t(add x undefined)"
+	tree, _ := Parse("test", src)
+	_, err := NewContext().Eval(tree)
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	expected := "test:2:9 unable to resolve undefined\n" +
+		"  2 | \t(add x undefined)\n" +
+		"    | \t       ^~~~~~~~~"
+	if s := e.Format(src); s != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, s)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Keys understood by the editor. Escape sequences for the arrow,
+// home and end keys are translated to their emacs equivalents.
+const (
+	keyDelete    rune = -1 // translated from an escape sequence
+	keyCtrlA     rune = 1
+	keyCtrlB     rune = 2
+	keyCtrlC     rune = 3
+	keyCtrlD     rune = 4
+	keyCtrlE     rune = 5
+	keyCtrlF     rune = 6
+	keyCtrlG     rune = 7
+	keyCtrlH     rune = 8
+	keyTab       rune = 9
+	keyCtrlK     rune = 11
+	keyCtrlL     rune = 12
+	keyEnter     rune = 13
+	keyCtrlN     rune = 14
+	keyCtrlP     rune = 16
+	keyCtrlR     rune = 18
+	keyCtrlU     rune = 21
+	keyCtrlW     rune = 23
+	keyEsc       rune = 27
+	keyBackspace rune = 127
+)
+
+// Maximum number of lines kept in the history.
+const maxHistory = 1000
+
+// errInterrupt is returned by readLine when the user presses Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+// editor reads lines from a terminal with emacs-style line editing,
+// history browsing and search, and tab completion. The terminal has
+// to be in raw mode while readLine runs.
+type editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	history     []string
+	historyFile string // History is not saved if empty.
+
+	// complete returns the candidates for completing prefix.
+	complete func(prefix string) []string
+
+	prompt string
+	buf    []rune
+	cursor int
+}
+
+func newEditor(in io.Reader, out io.Writer, complete func(string) []string) *editor {
+	return &editor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		complete: complete,
+	}
+}
+
+// readLine reads a line of input. It returns io.EOF when Ctrl-D is
+// pressed on an empty line, and errInterrupt when Ctrl-C is pressed.
+func (e *editor) readLine(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf = nil
+	e.cursor = 0
+
+	// Position while browsing the history, and the line
+	// that was being edited before browsing started.
+	index := len(e.history)
+	edited := ""
+
+	var pending rune
+	e.refresh()
+	for {
+		r := pending
+		pending = 0
+		if r == 0 {
+			var err error
+			if r, err = e.readKey(); err != nil {
+				return "", err
+			}
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.buf)
+			e.addHistory(line)
+			return line, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete()
+		case keyDelete:
+			e.delete()
+		case keyBackspace, keyCtrlH:
+			if e.cursor > 0 {
+				e.cursor--
+				e.delete()
+			}
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.buf)
+		case keyCtrlB:
+			if e.cursor > 0 {
+				e.cursor--
+			}
+		case keyCtrlF:
+			if e.cursor < len(e.buf) {
+				e.cursor++
+			}
+		case keyCtrlK:
+			e.buf = e.buf[:e.cursor]
+		case keyCtrlU:
+			e.buf = e.buf[e.cursor:]
+			e.cursor = 0
+		case keyCtrlW:
+			start := e.cursor
+			for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.cursor:]...)
+			e.cursor = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			if index > 0 {
+				if index == len(e.history) {
+					edited = string(e.buf)
+				}
+				index--
+				e.setLine(e.history[index])
+			}
+		case keyCtrlN:
+			if index < len(e.history) {
+				index++
+				if index == len(e.history) {
+					e.setLine(edited)
+				} else {
+					e.setLine(e.history[index])
+				}
+			}
+		case keyCtrlR:
+			var err error
+			if pending, err = e.search(); err != nil {
+				return "", err
+			}
+		case keyTab:
+			e.completeWord()
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+		e.refresh()
+	}
+}
+
+// readKey reads a key press, translating escape sequences.
+// It returns 0 for unknown escape sequences.
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEsc {
+		return r, err
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != '[' && r != 'O' {
+		return 0, nil
+	}
+
+	// Read parameters up to the final byte of the sequence.
+	param := ""
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		param += string(r)
+	}
+
+	switch r {
+	case 'A':
+		return keyCtrlP, nil
+	case 'B':
+		return keyCtrlN, nil
+	case 'C':
+		return keyCtrlF, nil
+	case 'D':
+		return keyCtrlB, nil
+	case 'H':
+		return keyCtrlA, nil
+	case 'F':
+		return keyCtrlE, nil
+	case '~':
+		switch param {
+		case "1", "7":
+			return keyCtrlA, nil
+		case "4", "8":
+			return keyCtrlE, nil
+		case "3":
+			return keyDelete, nil
+		}
+	}
+	return 0, nil
+}
+
+// search implements reverse incremental search through the history,
+// started by Ctrl-R. The line found replaces the current line. It
+// returns the key that ended the search, to be handled by readLine,
+// or 0 if the key was consumed.
+func (e *editor) search() (rune, error) {
+	original := string(e.buf)
+	query := ""
+	match := len(e.history)
+	failing := false
+
+	// find looks for the query in the history, starting at index from.
+	find := func(from int) {
+		if from >= len(e.history) {
+			from = len(e.history) - 1
+		}
+		for i := from; i >= 0; i-- {
+			if at := strings.Index(e.history[i], query); at >= 0 {
+				match = i
+				failing = false
+				e.setLine(e.history[i])
+				e.cursor = len([]rune(e.history[i][:at]))
+				return
+			}
+		}
+		failing = true
+	}
+
+	for {
+		status := "reverse-i-search"
+		if failing {
+			status = "failing " + status
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", status, query, string(e.buf))
+
+		r, err := e.readKey()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case r == keyCtrlR:
+			if query != "" {
+				find(match - 1)
+			}
+		case r == keyBackspace || r == keyCtrlH:
+			if query != "" {
+				q := []rune(query)
+				query = string(q[:len(q)-1])
+				find(len(e.history) - 1)
+			}
+		case r == keyCtrlG || r == keyCtrlC:
+			e.setLine(original)
+			return 0, nil
+		case r > 0 && unicode.IsPrint(r):
+			query += string(r)
+			find(match)
+		default:
+			return r, nil
+		}
+	}
+}
+
+// completeWord completes the identifier before the cursor. If there
+// are several candidates, it inserts their common prefix, or lists
+// them when there is nothing to insert.
+func (e *editor) completeWord() {
+	start := e.cursor
+	for start > 0 && !strings.ContainsRune(" \t()'\"", e.buf[start-1]) {
+		start--
+	}
+	prefix := string(e.buf[start:e.cursor])
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+
+	common := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, string(common)) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	if n := len([]rune(prefix)); len(common) > n {
+		for _, r := range common[n:] {
+			e.insert(r)
+		}
+	} else if len(candidates) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+func (e *editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.cursor+1:], e.buf[e.cursor:])
+	e.buf[e.cursor] = r
+	e.cursor++
+}
+
+// delete removes the rune under the cursor.
+func (e *editor) delete() {
+	if e.cursor < len(e.buf) {
+		e.buf = append(e.buf[:e.cursor], e.buf[e.cursor+1:]...)
+	}
+}
+
+func (e *editor) setLine(line string) {
+	e.buf = []rune(line)
+	e.cursor = len(e.buf)
+}
+
+// refresh redraws the prompt and line, and positions the cursor.
+func (e *editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if n := len(e.buf) - e.cursor; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+// addHistory adds line to the history and appends
+// it to the history file.
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// loadHistory reads the history from file and saves
+// history added later on to it. The file is trimmed if
+// it grew beyond the history limit.
+func (e *editor) loadHistory(file string) error {
+	e.historyFile = file
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		content := strings.Join(lines, "\n") + "\n"
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			return err
+		}
+	}
+	e.history = lines
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	input := strings.Join([]string{
+		"(add 1 2)\r",
+		"(pts\x1b[D\x1b[Du\r",               // arrow keys move the cursor
+		"\x1b[A\x1b[A\x01\x0b(sub\t 3 1)\r", // history, Ctrl-A, Ctrl-K, completion
+		"\x12add\r",                         // Ctrl-R search
+		"foo\x03",                           // Ctrl-C
+		"\x04",                              // Ctrl-D
+	}, "")
+	complete := func(prefix string) []string {
+		names := []string{}
+		for _, name := range []string{"add", "subtract", "puts"} {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	ed := newEditor(strings.NewReader(input), ioutil.Discard, complete)
+
+	expected := []string{"(add 1 2)", "(puts", "(subtract 3 1)", "(add 1 2)"}
+	for _, exp := range expected {
+		line, err := ed.readLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != exp {
+			t.Errorf("expected %q, got %q", exp, line)
+		}
+	}
+	if _, err := ed.readLine("> "); err != errInterrupt {
+		t.Errorf("expected interrupt, got %v", err)
+	}
+	if _, err := ed.readLine("> "); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if len(ed.history) != 4 {
+		t.Errorf("expected 4 history entries, got %q", ed.history)
+	}
+}
@@ -1,40 +1,102 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/mrdg/fatlisp"
+	"io"
 	"io/ioutil"
 	"os"
 )
 
 func main() {
-	flag.Parse()
-
-	if flag.NArg() < 1 {
-		fmt.Fprintf(os.Stderr, "usage: %s <file>\n", os.Args[0])
+	interactive := flag.Bool("i", false, "start an interactive session after running the program")
+	expr := flag.String("e", "", "evaluate `expr` instead of reading a file")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-i] [-e expr | file | -] [args...]\n", os.Args[0])
 		flag.PrintDefaults()
-		os.Exit(1)
 	}
-	file := flag.Arg(0)
+	flag.Parse()
 
-	src, err := ioutil.ReadFile(file)
+	name, src, args, err := program(*expr, flag.Args(), os.Stdin)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-
-	tree, err := fatlisp.Parse(file, string(src))
+	ctx, err := newContext(args)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
+	sources := map[string]string{}
+	if name != "" {
+		sources[name] = src
+		_, err := evalString(ctx, name, src)
+		if err != nil {
+			printError(os.Stderr, err, sources)
+			if !*interactive {
+				os.Exit(1)
+			}
+		}
+	}
+
+	if name == "" || *interactive {
+		repl(ctx, newLineReader(ctx), os.Stdout, os.Stderr, sources)
+	}
+}
+
+// program returns the name and source of the program to run, which
+// is given by expr, or by the first of args. The name "-" means the
+// program is read from stdin. The remaining arguments are returned
+// to be passed on to the program. name is empty if there is no
+// program.
+func program(expr string, args []string, stdin io.Reader) (name, src string, rest []string, err error) {
+	switch {
+	case expr != "":
+		return "-e", expr, args, nil
+	case len(args) == 0:
+		return "", "", args, nil
+	}
+
+	name, args = args[0], args[1:]
+	var data []byte
+	if name == "-" {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	return name, string(data), args, err
+}
+
+// newContext returns the context programs run in, with
+// args bound to *args*.
+func newContext(args []string) (*fatlisp.Context, error) {
 	ctx := fatlisp.NewContext()
+	if err := ctx.Bind("*args*", args); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
 
-	_, err = ctx.Eval(tree)
+func evalString(ctx *fatlisp.Context, name, src string) ([]fatlisp.Value, error) {
+	tree, err := fatlisp.Parse(name, src)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return nil, err
+	}
+	return ctx.Eval(tree)
+}
+
+// printError prints err, with an excerpt of the source it points
+// to if that is found in sources, which maps file names to source.
+func printError(w io.Writer, err error, sources map[string]string) {
+	var e *fatlisp.Error
+	if errors.As(err, &e) {
+		if src, ok := sources[e.Pos.File]; ok {
+			fmt.Fprintln(w, e.Format(src))
+			return
+		}
 	}
+	fmt.Fprintln(w, err)
 }
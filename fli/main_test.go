@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prog.fl")
+	if err := os.WriteFile(file, []byte("(puts *args*)"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr  string
+		args  []string
+		stdin string
+		name  string
+		src   string
+		rest  string
+	}{
+		{"", []string{}, "", "", "", "()"},
+		{"(add 1 2)", []string{"a", "b"}, "", "-e", "(add 1 2)", "(a b)"},
+		{"", []string{"-", "a"}, "(add 3 4)", "-", "(add 3 4)", "(a)"},
+		{"", []string{file, "a", "b"}, "", file, "(puts *args*)", "(a b)"},
+	}
+
+	for _, test := range tests {
+		name, src, rest, err := program(test.expr, test.args, strings.NewReader(test.stdin))
+		if err != nil {
+			t.Errorf("%v: %v", test.args, err)
+			continue
+		}
+		if name != test.name || src != test.src {
+			t.Errorf("%v: expected program %q %q, got %q %q", test.args, test.name, test.src, name, src)
+		}
+
+		// The remaining arguments are bound to *args*.
+		ctx, err := newContext(rest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := evalString(ctx, "test", "*args*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := results[0].String(); s != test.rest {
+			t.Errorf("%v: expected *args* %s, got %s", test.args, test.rest, s)
+		}
+	}
+
+	if _, _, _, err := program("", []string{"missing.fl"}, nil); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
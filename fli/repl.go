@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mrdg/fatlisp"
+)
+
+const (
+	prompt     = "> "
+	contPrompt = ". "
+)
+
+// Name of the history file in the user's home directory.
+const historyFile = ".fli_history"
+
+type lineReader interface {
+	// readLine shows prompt and reads a line of input,
+	// without the trailing newline.
+	readLine(prompt string) (string, error)
+}
+
+// repl reads forms from lines and evaluates them in ctx, until the
+// input is exhausted. Results are printed to out and errors to errOut.
+// A form can span multiple lines: input is evaluated once all of its
+// lists and strings are closed. Each input is named repl:N, and added
+// to sources, which maps file names to their source for printing
+// errors.
+func repl(ctx *fatlisp.Context, lines lineReader, out, errOut io.Writer, sources map[string]string) {
+	src := ""
+	n := 0
+	for {
+		p := prompt
+		if src != "" {
+			p = contPrompt
+		}
+		line, err := lines.readLine(p)
+		if err == errInterrupt {
+			src = ""
+			continue
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return
+		}
+
+		src += line + "\n"
+		if !fatlisp.Complete(src) {
+			continue
+		}
+
+		n++
+		name := fmt.Sprintf("repl:%d", n)
+		sources[name] = src
+		results, err := evalString(ctx, name, src)
+		for _, v := range results {
+			fmt.Fprintln(out, v)
+		}
+		if err != nil {
+			printError(errOut, err, sources)
+		}
+		src = ""
+	}
+}
+
+// newLineReader returns a line editor if stdin and stdout are
+// terminals, and a plain line reader otherwise.
+func newLineReader(ctx *fatlisp.Context) lineReader {
+	if !isTerminal(int(os.Stdin.Fd())) || !isTerminal(int(os.Stdout.Fd())) {
+		return &scanReader{bufio.NewScanner(os.Stdin), os.Stdout}
+	}
+
+	complete := func(prefix string) []string {
+		names := []string{}
+		for _, name := range ctx.Names() {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	ed := newEditor(os.Stdin, os.Stdout, complete)
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := ed.loadHistory(filepath.Join(home, historyFile)); err != nil {
+			fmt.Fprintln(os.Stderr, "unable to load history:", err)
+		}
+	}
+	return &termReader{int(os.Stdin.Fd()), ed}
+}
+
+// termReader reads lines from a terminal using an editor.
+type termReader struct {
+	fd int
+	ed *editor
+}
+
+func (t *termReader) readLine(prompt string) (string, error) {
+	state, err := makeRaw(t.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore(t.fd, state)
+	return t.ed.readLine(prompt)
+}
+
+// scanReader reads lines from input that isn't a terminal.
+type scanReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (s *scanReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(s.out, prompt)
+	if !s.scanner.Scan() {
+		fmt.Fprintln(s.out)
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
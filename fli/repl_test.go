@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mrdg/fatlisp"
+)
+
+// lines is a lineReader returning a fixed list of lines.
+type lines []string
+
+func (l *lines) readLine(prompt string) (string, error) {
+	if len(*l) == 0 {
+		return "", io.EOF
+	}
+	line := (*l)[0]
+	*l = (*l)[1:]
+	return line, nil
+}
+
+func TestRepl(t *testing.T) {
+	input := lines{
+		`(def f (fn (x)`,
+		`  (add x "a")))`,
+		`(add 1`,
+		`  2)`,
+		`(undefined)`,
+		``,
+		`(f`,
+		`  1)`,
+		`"done"`,
+	}
+	var out, errOut bytes.Buffer
+	repl(fatlisp.NewContext(), &input, &out, &errOut, map[string]string{})
+
+	if expected := "f\n3\ndone\n"; out.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, out.String())
+	}
+
+	// The error in f is shown in the input that defined it.
+	for _, s := range []string{
+		"repl:3:1:2 unable to resolve undefined",
+		"repl:1:2:10 unexpected type String\n  2 |   (add x \"a\")))\n    |          ^~~",
+	} {
+		if !strings.Contains(errOut.String(), s) {
+			t.Errorf("expected errors to contain %q, got\n%s", s, errOut.String())
+		}
+	}
+}
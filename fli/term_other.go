@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+type termState struct{}
+
+// Line editing is only supported on Linux. Elsewhere
+// the REPL reads plain lines from standard input.
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("raw mode not supported")
+}
+
+func restore(fd int, state *termState) error {
+	return nil
+}
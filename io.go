@@ -0,0 +1,70 @@
+package fatlisp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// defineIO adds the builtins that use the streams of the context.
+func (ctx *Context) defineIO() {
+	ctx.Define("puts", ctx.puts, 0, -1)
+	ctx.Define("eputs", ctx.eputs, 0, -1)
+	ctx.Define("read-line", ctx.readLine, 0, 0)
+}
+
+// puts prints its arguments to Stdout, followed by a newline.
+func (ctx *Context) puts(vals ...Value) (Value, error) {
+	return fprint(ctx.Stdout, vals)
+}
+
+// eputs prints its arguments to Stderr, followed by a newline.
+func (ctx *Context) eputs(vals ...Value) (Value, error) {
+	return fprint(ctx.Stderr, vals)
+}
+
+func fprint(w io.Writer, vals []Value) (Value, error) {
+	for _, v := range vals {
+		if _, err := fmt.Fprint(w, v, " "); err != nil {
+			return Value{}, err
+		}
+	}
+	if _, err := fmt.Fprint(w, "\n"); err != nil {
+		return Value{}, err
+	}
+	return Value{typ: nilType}, nil
+}
+
+// readLine reads a line from Stdin, without the trailing newline.
+// It returns nil at the end of the input.
+func (ctx *Context) readLine(vals ...Value) (Value, error) {
+	if ctx.stdin == nil || !sameReader(ctx.in, ctx.Stdin) {
+		ctx.stdin = bufio.NewReader(ctx.Stdin)
+		ctx.in = ctx.Stdin
+	}
+
+	line, err := ctx.stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return Value{typ: nilType}, nil
+	}
+	if err != nil && err != io.EOF {
+		return Value{}, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return Value{typ: stringType, data: line}, nil
+}
+
+// sameReader reports whether a and b are the same reader. Unlike ==,
+// it doesn't panic if their type isn't comparable.
+func sameReader(a, b io.Reader) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	if a == nil || reflect.TypeOf(a).Comparable() {
+		return a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
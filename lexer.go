@@ -2,27 +2,18 @@ package fatlisp
 
 import (
 	"fmt"
+	"io"
 	"strings"
-	"unicode"
 	"unicode/utf8"
 )
 
 type item struct {
 	typ itemType
-	pos pos
+	pos Pos // start of the token
+	end Pos // position just after the token
 	val string
 }
 
-type pos struct {
-	file string
-	line int
-	col  int
-}
-
-func (p pos) String() string {
-	return fmt.Sprintf("%s:%d:%d", p.file, p.line, p.col)
-}
-
 type itemType int
 
 const (
@@ -34,6 +25,7 @@ const (
 	itemIdentifier
 	itemString
 	itemQuote
+	itemDiscard
 )
 
 const (
@@ -43,14 +35,38 @@ const (
 
 const eof = 1
 
+// Message of the error emitted when the input ends inside a string or comment.
+const errUnexpectedEOF = "unexpected EOF"
+
 type lexer struct {
-	name    string
-	input   string // the string being scanned
-	start   int    // start position of this item
-	pos     int    // current position in the input
-	width   int
-	nesting int // the level of nested parentheses
-	items   chan item
+	name  string
+	input string // the string being scanned
+	start int    // start position of this item
+	pos   int    // current position in the input
+	width int
+
+	// Line and column of start and pos, tracked as the lexer
+	// advances. prev is the position before the last call to
+	// next, so backup can restore it.
+	startPos Pos
+	cur      Pos
+	prev     Pos
+	nesting  int // the level of nested parentheses, used by Complete
+
+	// The lexer is a state machine driven by NextToken, which runs
+	// states until an item is emitted. items holds emitted items
+	// that were not returned yet, starting at index head.
+	state stateFn
+	items []item
+	head  int
+
+	// If reader is set, input is a window on the data read from it,
+	// which is refilled by next. Input before the start of the current
+	// item is dropped when refilling. err holds the error that ended
+	// reading, if it wasn't io.EOF.
+	reader io.Reader
+	buf    []byte
+	err    error
 }
 
 type stateFn func(*lexer) stateFn
@@ -69,55 +85,69 @@ func (i item) String() string {
 }
 
 func Lex(name, input string) *lexer {
+	start := Pos{File: name, Line: 1, Col: 1}
 	l := &lexer{
-		name:    name,
-		input:   input,
-		nesting: 0,
-		items:   make(chan item),
+		name:     name,
+		input:    input,
+		nesting:  0,
+		state:    lexTokens,
+		startPos: start,
+		cur:      start,
 	}
-	go l.run()
 	return l
 }
 
-func (l *lexer) NextToken() item {
-	return <-l.items
+// lexReader is like Lex, but reads its input from r as needed.
+func lexReader(name string, r io.Reader) *lexer {
+	l := Lex(name, "")
+	l.reader = r
+	l.buf = make([]byte, 4096)
+	return l
 }
 
-func (l *lexer) run() {
-	for state := lexTokens; state != nil; {
-		state = state(l)
+// Complete reports whether input ends outside of any list or string.
+// A REPL can use it to decide whether to read more input before
+// evaluating. Other syntax errors are left for Parse to report.
+func Complete(input string) bool {
+	l := Lex("", input)
+	for {
+		item := l.NextToken()
+		switch item.typ {
+		case itemEOF:
+			return l.nesting <= 0
+		case itemError:
+			return item.val != errUnexpectedEOF
+		}
 	}
-	close(l.items)
 }
 
-func (l *lexer) emit(t itemType) {
-	l.items <- item{t, l.currentPos(), l.input[l.start:l.pos]}
-	l.start = l.pos
-}
-
-// currentPos return the position of the current
-// token in the input string.
-func (l *lexer) currentPos() pos {
-	line := 1
-	col := 1
-
-	for i, c := range l.input[:l.start] {
-		if c == '\n' {
-			if i == l.start-1 {
-				break
-			}
-			line++
-			col = 1
-		} else {
-			col++
+// NextToken returns the next item from the input. After an EOF
+// or error item has been returned, it keeps returning EOF.
+func (l *lexer) NextToken() item {
+	for l.head == len(l.items) {
+		if l.state == nil {
+			return item{itemEOF, l.cur, l.cur, ""}
 		}
+		l.items = l.items[:0]
+		l.head = 0
+		l.state = l.state(l)
 	}
+	i := l.items[l.head]
+	l.head++
+	return i
+}
 
-	return pos{l.name, line, col}
+func (l *lexer) emit(t itemType) {
+	l.items = append(l.items, item{t, l.startPos, l.cur, l.input[l.start:l.pos]})
+	l.start = l.pos
+	l.startPos = l.cur
 }
 
 // next returns the next rune in the input.
 func (l *lexer) next() rune {
+	for l.reader != nil && !utf8.FullRuneInString(l.input[l.pos:]) {
+		l.fill()
+	}
 	if int(l.pos) >= len(l.input) {
 		l.width = 0
 		return eof
@@ -125,18 +155,71 @@ func (l *lexer) next() rune {
 	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
 	l.width = w
 	l.pos += l.width
+
+	l.prev = l.cur
+	l.cur.Offset += w
+	if r == '\n' {
+		l.cur.Line++
+		l.cur.Col = 1
+	} else {
+		l.cur.Col++
+	}
 	return r
 }
 
+// fill reads more input from the reader, dropping the input
+// before the start of the current item. The reader is unset
+// once it's exhausted.
+func (l *lexer) fill() {
+	n, err := l.reader.Read(l.buf)
+	l.input = l.input[l.start:] + string(l.buf[:n])
+	l.pos -= l.start
+	l.start = 0
+	if err != nil {
+		if err != io.EOF {
+			l.err = err
+		}
+		l.reader = nil
+	}
+}
+
 // ignore skips over the pending input before this point.
 func (l *lexer) ignore() {
 	l.start = l.pos
+	l.startPos = l.cur
+}
+
+// resync moves the lexer to pos, and skips the input up to the next
+// line that starts with '(', which is likely the start of a top-level
+// form. The parser uses it to continue after a syntax error. It only
+// works if the lexer reads from a string.
+func (l *lexer) resync(pos Pos) {
+	l.pos = pos.Offset
+	l.cur = pos
+	for {
+		r := l.next()
+		if r == eof {
+			break
+		}
+		if r == startList && l.prev.Col == 1 {
+			l.backup()
+			break
+		}
+	}
+	l.ignore()
+	l.nesting = 0
+	l.items = l.items[:0]
+	l.head = 0
+	l.state = lexTokens
 }
 
 // backup steps back one rune.
 // Can be called only once per call of next.
 func (l *lexer) backup() {
-	l.pos -= l.width
+	if l.width > 0 {
+		l.pos -= l.width
+		l.cur = l.prev
+	}
 }
 
 // peek returns but does not consume
@@ -148,10 +231,25 @@ func (l *lexer) peek() rune {
 }
 
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{itemError, l.currentPos(), fmt.Sprintf(format, args...)}
+	return l.errorAt(l.startPos, format, args...)
+}
+
+// errorAt is like errorf, but reports the error at
+// pos instead of the start of the current token.
+func (l *lexer) errorAt(pos Pos, format string, args ...interface{}) stateFn {
+	l.items = append(l.items, item{itemError, pos, pos, fmt.Sprintf(format, args...)})
 	return nil
 }
 
+// accept consumes the next rune if it's from the valid set.
+func (l *lexer) accept(valid string) bool {
+	if strings.ContainsRune(valid, l.next()) {
+		return true
+	}
+	l.backup()
+	return false
+}
+
 func lexStartList(l *lexer) stateFn {
 	l.emit(itemStartList)
 	l.nesting++
@@ -162,30 +260,37 @@ func lexTokens(l *lexer) stateFn {
 	for {
 		switch r := l.next(); {
 		case r == eof:
-			if l.nesting > 0 {
-				return l.errorf("unexpected EOF")
-			} else {
-				l.emit(itemEOF)
-				return nil
-			}
+			// Unbalanced parentheses are reported by the parser,
+			// which knows where the unclosed lists were opened.
+			l.emit(itemEOF)
+			return nil
 		case isSpace(r):
 			l.ignore()
 		case r == '+' || r == '-':
-			if unicode.IsDigit(l.peek()) {
+			if isDigit(l.peek()) {
 				return lexNumber
 			} else {
 				return lexIdentifier
 			}
-		case unicode.IsDigit(r):
+		case isDigit(r):
 			return lexNumber
 		case r == '"':
 			return lexString
+		case r == '`':
+			return lexRawString
 		case r == startList:
 			return lexStartList
 		case r == closeList:
 			return lexCloseList
 		case r == '\'':
 			l.emit(itemQuote)
+		case r == ';':
+			return lexLineComment
+		case r == '#' && l.peek() == '|':
+			return lexBlockComment
+		case r == '#' && l.peek() == '_':
+			l.next()
+			l.emit(itemDiscard)
 		default:
 			if utf8.ValidRune(r) {
 				return lexIdentifier
@@ -194,7 +299,6 @@ func lexTokens(l *lexer) stateFn {
 			}
 		}
 	}
-	return nil
 }
 
 func lexCloseList(l *lexer) stateFn {
@@ -203,25 +307,100 @@ func lexCloseList(l *lexer) stateFn {
 	return lexTokens
 }
 
+const (
+	decimalDigits = "0123456789"
+	hexDigits     = "0123456789abcdefABCDEF"
+	octalDigits   = "01234567"
+	binaryDigits  = "01"
+)
+
+// lexNumber scans a number. Numbers have an optional sign and are
+// either integers with a base prefix (0x1F, 0o17, 0b1010), or
+// decimals with an optional fraction and exponent (42, 3.14, 1e-9).
+// Digits can be separated by underscores (1_000_000).
 func lexNumber(l *lexer) stateFn {
-	for strings.IndexRune("+-.0123456789", l.next()) >= 0 {
+	// Rescan the sign or first digit
+	l.pos = l.start
+	l.cur = l.startPos
+	l.accept("+-")
+
+	digits, base := decimalDigits, "decimal"
+	if l.accept("0") {
+		switch {
+		case l.accept("xX"):
+			digits, base = hexDigits, "hex"
+		case l.accept("oO"):
+			digits, base = octalDigits, "octal"
+		case l.accept("bB"):
+			digits, base = binaryDigits, "binary"
+		}
+	}
+
+	if digits != decimalDigits {
+		if n, state := lexDigits(l, digits); state != nil {
+			return state
+		} else if n == 0 {
+			return l.errorAt(l.cur, "expected %s digit in number", base)
+		}
+	} else {
+		if _, state := lexDigits(l, digits); state != nil {
+			return state
+		}
+		if l.accept(".") {
+			if n, state := lexDigits(l, digits); state != nil {
+				return state
+			} else if n == 0 {
+				return l.errorAt(l.cur, "expected digit after decimal point")
+			}
+		}
+		if l.accept("eE") {
+			l.accept("+-")
+			if n, state := lexDigits(l, digits); state != nil {
+				return state
+			} else if n == 0 {
+				return l.errorAt(l.cur, "expected digit in exponent")
+			}
+		}
 	}
-	l.backup()
 
 	// Consider number invalid if it ends with anything
-	// but a space, (, ) or eof
-	r := l.peek()
-	if !isDelimiter(r) {
-		return l.errorf("Invalid number")
+	// but a space, (, ), ; or eof
+	if r := l.peek(); !isDelimiter(r) {
+		return l.errorAt(l.cur, "invalid character %q in number", r)
 	}
 	l.emit(itemNumber)
 	return lexTokens
 }
 
+// lexDigits scans a run of digits from the valid set, which may be
+// separated by single underscores. It returns the number of digits
+// scanned, and a non-nil stateFn if an underscore is misplaced.
+func lexDigits(l *lexer, valid string) (int, stateFn) {
+	n := 0
+	for {
+		if l.accept(valid) {
+			n++
+			continue
+		}
+		if l.peek() != '_' {
+			return n, nil
+		}
+
+		// An underscore has to follow a digit or base
+		// prefix, and has to be followed by a digit.
+		underscore := l.cur
+		prev := rune(l.input[l.pos-1])
+		l.next()
+		if !strings.ContainsRune(valid+"xXoObB", prev) || !strings.ContainsRune(valid, l.peek()) {
+			return n, l.errorAt(underscore, "'_' must separate digits in number")
+		}
+	}
+}
+
 func lexIdentifier(l *lexer) stateFn {
 	for {
 		r := l.next()
-		if isDelimiter(r) || r == '"' || !utf8.ValidRune(r) {
+		if isDelimiter(r) || r == '"' || r == '`' || !utf8.ValidRune(r) {
 			l.backup()
 			break
 		}
@@ -231,24 +410,107 @@ func lexIdentifier(l *lexer) stateFn {
 	return lexTokens
 }
 
+// lexString scans a string delimited by double quotes. Escape
+// sequences are validated here, and decoded by the parser.
 func lexString(l *lexer) stateFn {
-	l.next() // accept the first quote
 	for {
 		r := l.next()
 		if r == '"' {
 			break
 		}
 		if r == eof {
-			return l.errorf("unexpected EOF")
+			return l.errorf(errUnexpectedEOF)
+		}
+		if r == '\\' {
+			if state := lexEscape(l, l.prev); state != nil {
+				return state
+			}
+		}
+	}
+	l.emit(itemString)
+	return lexTokens
+}
+
+// lexEscape scans an escape sequence after the backslash at pos.
+// It returns a non-nil stateFn if the sequence is invalid.
+func lexEscape(l *lexer, pos Pos) stateFn {
+	switch r := l.next(); r {
+	case '"', '\\', 'n', 't', 'r':
+		return nil
+	case 'u':
+		for i := 0; i < 4; i++ {
+			if !isHexDigit(l.next()) {
+				return l.errorAt(pos, "invalid escape sequence: \\u needs 4 hex digits")
+			}
+		}
+		return nil
+	case eof:
+		return l.errorf(errUnexpectedEOF)
+	default:
+		return l.errorAt(pos, "unknown escape sequence \\%c", r)
+	}
+}
+
+// lexRawString scans a string delimited by backquotes. It
+// can span multiple lines and has no escape sequences.
+func lexRawString(l *lexer) stateFn {
+	for {
+		r := l.next()
+		if r == '`' {
+			break
+		}
+		if r == eof {
+			return l.errorf(errUnexpectedEOF)
 		}
 	}
 	l.emit(itemString)
 	return lexTokens
 }
 
+func isHexDigit(r rune) bool {
+	return strings.ContainsRune("0123456789abcdefABCDEF", r)
+}
+
+// lexLineComment skips a comment running from ; to the end of the line.
+func lexLineComment(l *lexer) stateFn {
+	for {
+		r := l.next()
+		if r == '\n' || r == eof {
+			break
+		}
+	}
+	l.ignore()
+	return lexTokens
+}
+
+// lexBlockComment skips a comment delimited by #| and |#.
+// Block comments can be nested.
+func lexBlockComment(l *lexer) stateFn {
+	l.next() // accept the | of the opening #|
+	depth := 1
+	for depth > 0 {
+		switch r := l.next(); {
+		case r == eof:
+			return l.errorf(errUnexpectedEOF)
+		case r == '#' && l.peek() == '|':
+			l.next()
+			depth++
+		case r == '|' && l.peek() == '#':
+			l.next()
+			depth--
+		}
+	}
+	l.ignore()
+	return lexTokens
+}
+
 // Tests whether r is a valid delimiter (to end a number or identifier token).
 func isDelimiter(r rune) bool {
-	return isSpace(r) || r == startList || r == closeList || r == eof
+	return isSpace(r) || r == startList || r == closeList || r == ';' || r == eof
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
 }
 
 func isSpace(r rune) bool {
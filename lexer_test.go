@@ -1,6 +1,7 @@
 package fatlisp
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -10,48 +11,167 @@ type lexTest struct {
 	items []item
 }
 
-var p = pos{"test", 1, 1}
+var p = Pos{File: "test", Line: 1, Col: 1}
 
 var lexTests = []lexTest{
 	{"Int", "42", []item{
-		item{itemNumber, p, "42"},
+		item{typ: itemNumber, pos: p, val: "42"},
 	}},
 	{"Float", "3.14159", []item{
-		item{itemNumber, p, "3.14159"},
+		item{typ: itemNumber, pos: p, val: "3.14159"},
 	}},
 	{"Number with + sign", "+42", []item{
-		item{itemNumber, p, "+42"},
+		item{typ: itemNumber, pos: p, val: "+42"},
 	}},
 	{"Number with - sign", "-42", []item{
-		item{itemNumber, p, "-42"},
+		item{typ: itemNumber, pos: p, val: "-42"},
 	}},
 	{"Invalid trailing character", "42d", []item{
-		item{itemError, p, "Invalid number"},
+		item{typ: itemError, pos: p, val: "invalid character 'd' in number"},
+	}},
+	{"Hex", "0x1F", []item{
+		item{typ: itemNumber, pos: p, val: "0x1F"},
+	}},
+	{"Binary", "-0b1010", []item{
+		item{typ: itemNumber, pos: p, val: "-0b1010"},
+	}},
+	{"Octal", "0o17", []item{
+		item{typ: itemNumber, pos: p, val: "0o17"},
+	}},
+	{"Exponent", "1.5e-9", []item{
+		item{typ: itemNumber, pos: p, val: "1.5e-9"},
+	}},
+	{"Digit separators", "1_000_000", []item{
+		item{typ: itemNumber, pos: p, val: "1_000_000"},
+	}},
+	{"Sign inside number", "1-2", []item{
+		item{typ: itemError, pos: p, val: "invalid character '-' in number"},
+	}},
+	{"Two decimal points", "1.2.3", []item{
+		item{typ: itemError, pos: p, val: "invalid character '.' in number"},
+	}},
+	{"Missing fraction", "1.", []item{
+		item{typ: itemError, pos: p, val: "expected digit after decimal point"},
+	}},
+	{"Missing exponent", "1e+", []item{
+		item{typ: itemError, pos: p, val: "expected digit in exponent"},
+	}},
+	{"Invalid binary digit", "0b102", []item{
+		item{typ: itemError, pos: p, val: "invalid character '2' in number"},
+	}},
+	{"Missing hex digits", "0x", []item{
+		item{typ: itemError, pos: p, val: "expected hex digit in number"},
+	}},
+	{"Trailing underscore", "1_", []item{
+		item{typ: itemError, pos: p, val: "'_' must separate digits in number"},
+	}},
+	{"Double underscore", "1__0", []item{
+		item{typ: itemError, pos: p, val: "'_' must separate digits in number"},
 	}},
 
 	{"String", `"A string"`, []item{
-		item{itemString, p, `"A string"`},
+		item{typ: itemString, pos: p, val: `"A string"`},
+	}},
+
+	{"Empty string", `""`, []item{
+		item{typ: itemString, pos: p, val: `""`},
+	}},
+	{"String with escapes", `"a\"b\\c\n\u00e9"`, []item{
+		item{typ: itemString, pos: p, val: `"a\"b\\c\n\u00e9"`},
+	}},
+	{"Unknown escape", `"a\qb"`, []item{
+		item{typ: itemError, pos: p, val: `unknown escape sequence \q`},
+	}},
+	{"Short unicode escape", `"\u12"`, []item{
+		item{typ: itemError, pos: p, val: `invalid escape sequence: \u needs 4 hex digits`},
+	}},
+	{"Raw string", "`a\n\\n\"b`", []item{
+		item{typ: itemString, pos: p, val: "`a\n\\n\"b`"},
 	}},
 
 	{"Identifier", "thing", []item{
-		item{itemIdentifier, p, "thing"},
+		item{typ: itemIdentifier, pos: p, val: "thing"},
 	}},
 
 	{"Brackets", "()", []item{
-		item{itemStartList, p, "("},
-		item{itemCloseList, p, ")"},
+		item{typ: itemStartList, pos: p, val: "("},
+		item{typ: itemCloseList, pos: p, val: ")"},
 	}},
 	{"Quote", "'foo", []item{
-		item{itemQuote, p, "'"},
-		item{itemIdentifier, p, "foo"},
+		item{typ: itemQuote, pos: p, val: "'"},
+		item{typ: itemIdentifier, pos: p, val: "foo"},
 	}},
 	{"Unclosed string", `"foo`, []item{
-		item{itemError, p, "unexpected EOF"},
+		item{typ: itemError, pos: p, val: "unexpected EOF"},
 	}},
 	{"Unclosed list", "(", []item{
-		item{itemStartList, p, "("},
-		item{itemError, p, "unexpected EOF"},
+		item{typ: itemStartList, pos: p, val: "("},
+		item{typ: itemEOF, pos: p, val: ""},
+	}},
+	{"Unbalanced list", ")(", []item{
+		item{typ: itemCloseList, pos: p, val: ")"},
+		item{typ: itemStartList, pos: p, val: "("},
+		item{typ: itemEOF, pos: p, val: ""},
+	}},
+
+	{"Line comment", "; comment\nfoo;bar", []item{
+		item{typ: itemIdentifier, pos: p, val: "foo"},
+		item{typ: itemEOF, pos: p, val: ""},
+	}},
+	{"Block comment", "#| a #| nested |# b |#foo", []item{
+		item{typ: itemIdentifier, pos: p, val: "foo"},
+	}},
+	{"Unclosed block comment", "#| a #| b |#", []item{
+		item{typ: itemError, pos: p, val: "unexpected EOF"},
 	}},
+	{"Discard", "#_foo", []item{
+		item{typ: itemDiscard, pos: p, val: "#_"},
+		item{typ: itemIdentifier, pos: p, val: "foo"},
+	}},
+}
+
+func TestNumberErrorPos(t *testing.T) {
+	tests := map[string]int{
+		"42d":      3,
+		"1.2.3":    4,
+		"0b102":    5,
+		"1_000__0": 6,
+		"(1e)":     4,
+	}
+	for input, col := range tests {
+		l := Lex("test", input)
+		tok := l.NextToken()
+		for tok.typ != itemError && tok.typ != itemEOF {
+			tok = l.NextToken()
+		}
+		if tok.typ != itemError || tok.pos.Col != col {
+			t.Errorf("%s: expected error at column %d, got %v at %s", input, col, tok, tok.pos)
+		}
+	}
+}
+
+func TestTokenSpans(t *testing.T) {
+	l := Lex("test", "(foo\n  \"héllo\")")
+	expected := []struct{ pos, end Pos }{
+		{Pos{"test", 1, 1, 0}, Pos{"test", 1, 2, 1}},
+		{Pos{"test", 1, 2, 1}, Pos{"test", 1, 5, 4}},
+		{Pos{"test", 2, 3, 7}, Pos{"test", 2, 10, 15}},
+		{Pos{"test", 2, 10, 15}, Pos{"test", 2, 11, 16}},
+	}
+	for _, exp := range expected {
+		tok := l.NextToken()
+		if tok.pos != exp.pos || tok.end != exp.end {
+			t.Errorf("%v: expected %s-%s, got %s-%s", tok, exp.pos, exp.end, tok.pos, tok.end)
+		}
+	}
+}
+
+func TestPosAfterComment(t *testing.T) {
+	l := Lex("test", "#| a\nb |# ; c\n  foo")
+	tok := l.NextToken()
+	if expected := (Pos{"test", 3, 3, 16}); tok.pos != expected {
+		t.Errorf("expected %s, got %s", expected, tok.pos)
+	}
 }
 
 func TestLex(t *testing.T) {
@@ -69,3 +189,28 @@ func TestLex(t *testing.T) {
 func testEqual(i1, i2 item) bool {
 	return i1.val == i2.val && i1.typ == i2.typ
 }
+
+// benchSource is a small program, repeated to get realistic input sizes.
+const benchSource = `; compute things
+(def square (fn (x) (multiply x x)))
+(def items '(1 2.5 0x1F "a string" #| block |# 1_000))
+(puts (square 12) "done\n")
+`
+
+func BenchmarkLex(b *testing.B) {
+	input := strings.Repeat(benchSource, 100)
+	b.SetBytes(int64(len(input)))
+	for i := 0; i < b.N; i++ {
+		l := Lex("bench", input)
+		for tok := l.NextToken(); tok.typ != itemEOF && tok.typ != itemError; tok = l.NextToken() {
+		}
+	}
+}
+
+func BenchmarkParseSnippet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse("bench", benchSource); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
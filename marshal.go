@@ -0,0 +1,466 @@
+package fatlisp
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var valueType = reflect.TypeOf(Value{})
+
+// Marshal converts the Go value v to a fatlisp value. Integers, floats,
+// strings and bools are converted to their fatlisp counterparts, and
+// slices and arrays to lists. Nil pointers, slices and interfaces become
+// nil. Maps and structs are converted to association lists of
+// (key value) pairs:
+//
+//	struct{ Name string; Port int }{"web", 80} -> ((Name "web") (Port 80))
+//
+// Map entries are sorted by key, so the output is stable.
+// Struct keys are identifiers, so the result reads like the quoted form
+// a script would write. The key for a field can be changed with a
+// fatlisp struct tag. Fields tagged with "-" and unexported fields are
+// skipped, and fields tagged with ",omitempty" are left out when they
+// hold the zero value:
+//
+//	Port int `fatlisp:"port,omitempty"`
+func Marshal(v interface{}) (Value, error) {
+	return goToValue(reflect.ValueOf(v), false)
+}
+
+// Unmarshal stores the fatlisp value v in the value pointed to by out,
+// following the mapping described for Marshal. Association list keys
+// can be identifiers or strings and are matched against struct keys
+// exactly, or failing that, case-insensitively. Keys without a
+// matching field are ignored, as are fields without a matching key.
+// If out points to an empty interface, lists become []interface{},
+// integers int64 and floats float64.
+func Unmarshal(v Value, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Unmarshal: expected non-nil pointer, got %T", out)
+	}
+	if err := unmarshal(v, rv.Elem()); err != nil {
+		return fmt.Errorf("Unmarshal: %v", err)
+	}
+	return nil
+}
+
+// goToValue converts a Go value to a fatlisp value. If objects is
+// true, structs and non-nil pointers to structs are converted to
+// objects, like Bind does. Otherwise, they are marshalled to association lists.
+func goToValue(rv reflect.Value, objects bool) (Value, error) {
+	return toValue(rv, objects, map[visit]bool{})
+}
+
+// visit identifies a pointer, map or slice being converted.
+type visit struct {
+	ptr uintptr
+	len int
+}
+
+// toValue implements goToValue. seen holds the pointers, maps and
+// slices being converted, to detect cycles.
+func toValue(rv reflect.Value, objects bool, seen map[visit]bool) (Value, error) {
+	if !rv.IsValid() {
+		return Value{typ: nilType}, nil
+	}
+	if rv.Type() == valueType {
+		return rv.Interface().(Value), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int2val(Int(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return Value{}, fmt.Errorf("%d overflows Int", rv.Uint())
+		}
+		return int2val(Int(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return float2val(Float(rv.Float())), nil
+	case reflect.String:
+		return Value{typ: stringType, data: rv.String()}, nil
+	case reflect.Bool:
+		return bool2val(rv.Bool()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice {
+			if rv.IsNil() {
+				return Value{typ: nilType}, nil
+			}
+			done, err := visiting(rv, seen)
+			if err != nil {
+				return Value{}, err
+			}
+			defer done()
+		}
+		vals := make([]Value, rv.Len())
+		for i := range vals {
+			v, err := toValue(rv.Index(i), objects, seen)
+			if err != nil {
+				return Value{}, err
+			}
+			vals[i] = v
+		}
+		return newList(vals...), nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return Value{typ: nilType}, nil
+		}
+		done, err := visiting(rv, seen)
+		if err != nil {
+			return Value{}, err
+		}
+		defer done()
+		vals := make([]Value, 0, rv.Len())
+		for _, k := range sortedKeys(rv) {
+			key, err := toValue(k, objects, seen)
+			if err != nil {
+				return Value{}, err
+			}
+			val, err := toValue(rv.MapIndex(k), objects, seen)
+			if err != nil {
+				return Value{}, err
+			}
+			vals = append(vals, newList(key, val))
+		}
+		return newList(vals...), nil
+	case reflect.Interface:
+		if rv.IsNil() {
+			return Value{typ: nilType}, nil
+		}
+		return toValue(rv.Elem(), objects, seen)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return Value{typ: nilType}, nil
+		}
+		if objects && rv.Elem().Kind() == reflect.Struct {
+			return Value{typ: objectType, data: rv}, nil
+		}
+		done, err := visiting(rv, seen)
+		if err != nil {
+			return Value{}, err
+		}
+		defer done()
+		return toValue(rv.Elem(), objects, seen)
+	case reflect.Struct:
+		if objects {
+			// Store a pointer to a copy, so methods with
+			// pointer receivers can be called as well.
+			ptr := reflect.New(rv.Type())
+			ptr.Elem().Set(rv)
+			return Value{typ: objectType, data: ptr}, nil
+		}
+		return structToValue(rv, seen)
+	case reflect.Func:
+		if rv.IsNil() {
+			return Value{typ: nilType}, nil
+		}
+		fn, err := newGoFn("fn", rv)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{typ: fnType, data: fn}, nil
+	}
+	return Value{}, fmt.Errorf("can't convert Go value of type %s", rv.Type())
+}
+
+// visiting records that the pointer, map or slice rv is being
+// converted, returning an error if it already is, which means
+// it contains itself. done must be called once it's converted.
+func visiting(rv reflect.Value, seen map[visit]bool) (done func(), err error) {
+	v := visit{rv.Pointer(), 0}
+	if rv.Kind() == reflect.Slice {
+		v.len = rv.Len()
+	}
+	if seen[v] {
+		return nil, fmt.Errorf("can't convert cyclic value of type %s", rv.Type())
+	}
+	seen[v] = true
+	return func() { delete(seen, v) }, nil
+}
+
+// sortedKeys returns the keys of the map rv in order, so maps
+// are marshalled the same way every time. Numbers are sorted by
+// value, other keys by their string form.
+func sortedKeys(rv reflect.Value) []reflect.Value {
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	return keys
+}
+
+func structToValue(rv reflect.Value, seen map[visit]bool) (Value, error) {
+	vals := []Value{}
+	for _, f := range structFields(rv.Type()) {
+		field := rv.Field(f.index)
+		if f.omitEmpty && field.IsZero() {
+			continue
+		}
+		val, err := toValue(field, false, seen)
+		if err != nil {
+			return Value{}, err
+		}
+		key := Value{typ: idType, data: f.name}
+		vals = append(vals, newList(key, val))
+	}
+	return newList(vals...), nil
+}
+
+// valueToGo converts v to a Go value of type t.
+func valueToGo(v Value, t reflect.Type) (reflect.Value, error) {
+	rv := reflect.New(t).Elem()
+	err := unmarshal(v, rv)
+	return rv, err
+}
+
+// unmarshal stores v in rv, which must be settable.
+func unmarshal(v Value, rv reflect.Value) error {
+	t := rv.Type()
+	if t == valueType {
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if v.typ == objectType {
+		obj := val2obj(v)
+		switch {
+		case obj.Type().AssignableTo(t):
+			rv.Set(obj)
+			return nil
+		case obj.Kind() == reflect.Ptr && obj.Elem().Type().AssignableTo(t):
+			rv.Set(obj.Elem())
+			return nil
+		}
+		return fmt.Errorf("can't use %s as %s", obj.Type(), t)
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.typ != intType {
+			break
+		}
+		i := int64(val2int(v))
+		if rv.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, t)
+		}
+		rv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.typ != intType {
+			break
+		}
+		i := int64(val2int(v))
+		if i < 0 || rv.OverflowUint(uint64(i)) {
+			return fmt.Errorf("%d overflows %s", i, t)
+		}
+		rv.SetUint(uint64(i))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if !isNumeric(v) {
+			break
+		}
+		rv.SetFloat(float64(val2num(v).toFloat()))
+		return nil
+	case reflect.String:
+		if v.typ != stringType {
+			break
+		}
+		rv.SetString(val2str(v))
+		return nil
+	case reflect.Bool:
+		if v.typ != boolType {
+			break
+		}
+		rv.SetBool(val2bool(v))
+		return nil
+	case reflect.Slice:
+		if v.typ == nilType {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		if v.typ != listType {
+			break
+		}
+		vals := val2slice(v)
+		rv.Set(reflect.MakeSlice(t, len(vals), len(vals)))
+		for i, val := range vals {
+			if err := unmarshal(val, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Array:
+		if v.typ != listType {
+			break
+		}
+		vals := val2slice(v)
+		if len(vals) != t.Len() {
+			return fmt.Errorf("can't use list of length %d as %s", len(vals), t)
+		}
+		for i, val := range vals {
+			if err := unmarshal(val, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.typ == nilType {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		if v.typ != listType {
+			break
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(t))
+		}
+		return eachPair(v, func(key, val Value) error {
+			k := reflect.New(t.Key()).Elem()
+			if t.Key().Kind() == reflect.String && key.typ == idType {
+				k.SetString(val2str(key))
+			} else if err := unmarshal(key, k); err != nil {
+				return err
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := unmarshal(val, elem); err != nil {
+				return err
+			}
+			rv.SetMapIndex(k, elem)
+			return nil
+		})
+	case reflect.Struct:
+		if v.typ != listType {
+			break
+		}
+		fields := structFields(t)
+		return eachPair(v, func(key, val Value) error {
+			if key.typ != idType && key.typ != stringType {
+				return fmt.Errorf("can't use %s as key for %s", key.typ, t)
+			}
+			f, ok := findField(fields, val2str(key))
+			if !ok {
+				return nil
+			}
+			if err := unmarshal(val, rv.Field(f.index)); err != nil {
+				return fmt.Errorf("%s.%s: %v", t, f.name, err)
+			}
+			return nil
+		})
+	case reflect.Ptr:
+		if v.typ == nilType {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(t.Elem()))
+		}
+		return unmarshal(v, rv.Elem())
+	case reflect.Interface:
+		if v.typ == nilType {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		if t.NumMethod() > 0 {
+			break
+		}
+		elem := reflect.New(defaultGoType(v)).Elem()
+		if err := unmarshal(v, elem); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+	case reflect.Func:
+		if v.typ == nilType {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+	}
+	return fmt.Errorf("can't use %s as %s", v.typ, t)
+}
+
+// eachPair calls fn for every (key value) pair in the association list v.
+func eachPair(v Value, fn func(key, val Value) error) error {
+	for _, pair := range val2slice(v) {
+		if pair.typ != listType || len(val2slice(pair)) != 2 {
+			return fmt.Errorf("expected (key value) pair, got %v", pair)
+		}
+		if err := fn(pair.get(0), pair.get(1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultGoType returns the Go type used for v when the
+// target type is an empty interface.
+func defaultGoType(v Value) reflect.Type {
+	switch v.typ {
+	case intType:
+		return reflect.TypeOf(int64(0))
+	case floatType:
+		return reflect.TypeOf(float64(0))
+	case stringType:
+		return reflect.TypeOf("")
+	case boolType:
+		return reflect.TypeOf(false)
+	case listType:
+		return reflect.TypeOf([]interface{}{})
+	}
+	return valueType
+}
+
+type structField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// structFields returns the fields of struct type t that
+// can be marshalled, with their names from struct tags.
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		tag := f.Tag.Get("fatlisp")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{name, i, opts == "omitempty"})
+	}
+	return fields
+}
+
+func findField(fields []structField, name string) (structField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
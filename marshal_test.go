@@ -0,0 +1,109 @@
+package fatlisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+type server struct {
+	Name    string
+	Port    int `fatlisp:"port"`
+	Tags    []string
+	Limits  map[string]float64 `fatlisp:"limits,omitempty"`
+	Backup  *server            `fatlisp:"backup,omitempty"`
+	private int
+}
+
+func TestMarshal(t *testing.T) {
+	s := server{Name: "web", Port: 80, Tags: []string{"a", "b"}}
+	v, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := v.String(); str != "((Name web) (port 80) (Tags (a b)))" {
+		t.Errorf("unexpected marshalled value %s", str)
+	}
+
+	maps := []struct {
+		in       interface{}
+		expected string
+	}{
+		{map[string]int{"c": 3, "a": 1, "b": 2, "d": 4}, "((a 1) (b 2) (c 3) (d 4))"},
+		{map[int]string{10: "x", -1: "y", 2: "z"}, "((-1 y) (2 z) (10 x))"},
+	}
+	for _, test := range maps {
+		v, err := Marshal(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str := v.String(); str != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, str)
+		}
+	}
+}
+
+type node struct {
+	Next *node
+}
+
+func TestMarshalErrors(t *testing.T) {
+	n := &node{}
+	n.Next = n
+	m := map[string]interface{}{}
+	m["self"] = m
+
+	tests := []struct {
+		in  interface{}
+		msg string
+	}{
+		{n, "can't convert cyclic value of type *fatlisp.node"},
+		{m, "can't convert cyclic value of type map[string]interface {}"},
+		{uint64(1<<63 + 5), "9223372036854775813 overflows Int"},
+	}
+	for _, test := range tests {
+		_, err := Marshal(test.in)
+		if err == nil || err.Error() != test.msg {
+			t.Errorf("%T: expected error %q, got %v", test.in, test.msg, err)
+		}
+	}
+
+	// The same pointer can occur more than once, if it's not a cycle.
+	leaf := &node{}
+	if _, err := Marshal([]*node{leaf, leaf}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	ctx := NewContext()
+	v := evalString(t, ctx, `'((name "web") (port 8080) (Tags ("a" "b"))
+		(limits ((cpu 0.5) (mem 2))) (backup ((Name "db"))) (unknown 1))`)
+
+	s := server{Name: "default", private: 1}
+	if err := Unmarshal(v, &s); err != nil {
+		t.Fatal(err)
+	}
+	expected := server{
+		Name:    "web",
+		Port:    8080,
+		Tags:    []string{"a", "b"},
+		Limits:  map[string]float64{"cpu": 0.5, "mem": 2},
+		Backup:  &server{Name: "db"},
+		private: 1,
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+
+	var x interface{}
+	if err := Unmarshal(evalString(t, ctx, `'(1 2.5 "s")`), &x); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, []interface{}{int64(1), 2.5, "s"}) {
+		t.Errorf("unexpected value %#v", x)
+	}
+
+	if err := Unmarshal(evalString(t, ctx, `'((port "80"))`), &s); err == nil {
+		t.Errorf("expected type error")
+	}
+}
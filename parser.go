@@ -1,8 +1,11 @@
 package fatlisp
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 )
 
 type parser struct {
@@ -17,12 +20,18 @@ type parser struct {
 	// Contains all quotes encountered during parsing. After
 	// parsing quotes will be expanded. e.g. '(1 2 3) -> (quote (1 2 3))
 	quotes []Quote
+
+	// Contains all #_ encountered during parsing. After quotes
+	// are expanded, the forms they precede are removed.
+	discards []discard
 }
 
 type Type int
 
 const (
-	intType Type = iota
+	// The type of the zero Value, which isn't a valid value.
+	invalidType Type = iota
+	intType
 	floatType
 	stringType
 	listType
@@ -31,14 +40,18 @@ const (
 	nilType
 	boolType
 	formType
+	objectType
 )
 
 type Value struct {
 	typ  Type
 	data interface{}
 
-	// Lexer token from which the value was parsed.
-	// Used to show the location of an error in source.
+	// Lexer token from which the value was parsed. Its pos and end
+	// span the whole expression, including the closing ) of a list.
+	// Values produced during evaluation take the origin of the
+	// expression they result from. Used to show the location of an
+	// error in source.
 	origin item
 }
 
@@ -55,9 +68,18 @@ type List struct {
 // list on index is replaced with (quote element). 'id' is the identifier that
 // becomes the first element in the list the quote expands to.
 type Quote struct {
-	list  *Value
-	index int
-	id    string
+	list   *Value
+	index  int
+	id     string
+	origin item
+}
+
+// Represents a #_ found in the lexer stream. After quotes are expanded,
+// the element in list on index is removed.
+type discard struct {
+	list   *Value
+	index  int
+	origin item
 }
 
 func newParser(name, input string) parser {
@@ -72,59 +94,241 @@ func newParser(name, input string) parser {
 	}
 }
 
+// Parse parses input, returning a list of the top-level forms in it.
 func Parse(name, input string) (Value, error) {
 	p := newParser(name, input)
 	return p.parse()
 }
 
-func (p parser) parse() (Value, error) {
+// ParseAll is like Parse, but doesn't stop at the first syntax error.
+// When it finds an error, it drops the top-level form containing it
+// and continues at the next line starting with '('. It returns the
+// forms that were parsed successfully, and the errors in the order
+// they were found. This lets editors and linters show every problem
+// in a file at once.
+func ParseAll(name, input string) (Value, []*Error) {
+	p := newParser(name, input)
+	forms := newList()
+	var errs []*Error
+	for {
+		form, err := p.parseForm()
+		if err == io.EOF {
+			return forms, errs
+		}
+		if err == nil {
+			forms.push(form)
+			continue
+		}
+
+		pos := p.lex.cur
+		var e *Error
+		if !errors.As(err, &e) {
+			e = &Error{Pos: pos, End: pos, Kind: ParseError, Msg: err.Error(), Err: err}
+		}
+
+		// If lists were left open at the end of the input, parsing
+		// continues at the next top-level form inside the unclosed
+		// one. If there is one, the error points at the unclosed
+		// top-level form rather than at the innermost open list.
+		var open *Value
+		if e.Kind == ParseError && e.Msg == errUnclosed {
+			open = p.stack[1]
+			pos = open.origin.end
+		}
+		p.reset()
+		p.lex.resync(pos)
+		if open != nil && p.lex.cur.Offset < len(input) {
+			e = newError(ParseError, open.origin, errUnclosed).(*Error)
+		}
+		errs = append(errs, e)
+	}
+}
+
+func (p *parser) parse() (Value, error) {
 	item := p.lex.NextToken()
 	for item.typ != itemEOF {
-		switch item.typ {
-		case itemStartList:
-			list := newList()
-			list.origin = item
-			p.currentList.push(list)
-			p.pushList(&list)
-
-		case itemCloseList:
-			p.popList()
-
-		case itemIdentifier:
-			p.currentList.push(parseIdentifier(item))
-
-		case itemNumber:
-			num, err := parseNumber(item)
-			if err != nil {
-				return num, err
+		if err := p.parseItem(item); err != nil {
+			return Value{}, err
+		}
+		item = p.lex.NextToken()
+	}
+	if err := p.checkClosed(); err != nil {
+		return Value{}, err
+	}
+	if err := p.expandQuotes(); err != nil {
+		return Value{}, err
+	}
+	if err := p.removeDiscards(); err != nil {
+		return Value{}, err
+	}
+	return *p.currentList, nil
+}
+
+// parseForm parses the next top-level form from the input, for use by
+// Reader. It returns io.EOF at the end of the input.
+func (p *parser) parseForm() (Value, error) {
+	root := p.stack[0]
+	for {
+		item := p.lex.NextToken()
+		if item.typ == itemEOF {
+			if p.lex.err != nil {
+				return Value{}, p.lex.err
+			}
+			if err := p.checkClosed(); err != nil {
+				return Value{}, err
+			}
+			// Report quotes and #_ at the end of the input.
+			if err := p.expandQuotes(); err != nil {
+				return Value{}, err
 			}
-			p.currentList.push(num)
+			if err := p.removeDiscards(); err != nil {
+				return Value{}, err
+			}
+			return Value{}, io.EOF
+		}
 
-		case itemString:
-			p.currentList.push(parseString(item))
+		if err := p.parseItem(item); err != nil {
+			return Value{}, err
+		}
+		if len(p.stack) > 1 || len(val2slice(*root)) == 0 || p.awaitingForm(root) {
+			continue
+		}
 
-		case itemError:
-			return Value{}, newError(item, item.val)
+		// A top-level form is complete.
+		if err := p.expandQuotes(); err != nil {
+			return Value{}, err
+		}
+		if err := p.removeDiscards(); err != nil {
+			return Value{}, err
+		}
+		p.quotes, p.discards = nil, nil
 
-		case itemQuote:
-			i := len(val2slice(*p.currentList))
-			q := Quote{list: p.currentList, index: i, id: "quote"}
-			p.quotes = append(p.quotes, q)
+		vals := val2slice(*root)
+		*root = newList()
+		if len(vals) > 0 {
+			return vals[0], nil
 		}
+	}
+}
 
-		item = p.lex.NextToken()
+// awaitingForm reports whether a quote or #_ in list is still waiting
+// for the form it applies to. Discards are checked the way they are
+// removed, so stacked discards like #_#_a b wait for all their forms.
+func (p *parser) awaitingForm(list *Value) bool {
+	n := len(val2slice(*list))
+	for _, q := range p.quotes {
+		if q.list == list && q.index >= n {
+			return true
+		}
 	}
-	p.expandQuotes()
-	return *p.currentList, nil
+	for i := len(p.discards) - 1; i >= 0; i-- {
+		d := p.discards[i]
+		if d.list != list {
+			continue
+		}
+		if d.index >= n {
+			return true
+		}
+		n--
+	}
+	return false
 }
 
-func (p *parser) expandQuotes() {
+// parseItem adds the value parsed from item to the tree.
+func (p *parser) parseItem(item item) error {
+	switch item.typ {
+	case itemStartList:
+		list := newList()
+		list.origin = item
+		p.currentList.push(list)
+		p.pushList(&list)
+
+	case itemCloseList:
+		if len(p.stack) == 1 {
+			return newError(ParseError, item, "unexpected ')'")
+		}
+		p.popList()
+
+		// Extend the span of the closed list, which is
+		// the last value of the enclosing list, to the ).
+		vals := val2slice(*p.currentList)
+		vals[len(vals)-1].origin.end = item.end
+
+	case itemIdentifier:
+		p.currentList.push(parseIdentifier(item))
+
+	case itemNumber:
+		num, err := parseNumber(item)
+		if err != nil {
+			return err
+		}
+		p.currentList.push(num)
+
+	case itemString:
+		p.currentList.push(parseString(item))
+
+	case itemError:
+		return newError(LexError, item, "%s", item.val)
+
+	case itemQuote:
+		i := len(val2slice(*p.currentList))
+		q := Quote{list: p.currentList, index: i, id: "quote", origin: item}
+		p.quotes = append(p.quotes, q)
+
+	case itemDiscard:
+		i := len(val2slice(*p.currentList))
+		d := discard{list: p.currentList, index: i, origin: item}
+		p.discards = append(p.discards, d)
+
+		// Quotes waiting for a form apply to the
+		// form after the one that is discarded.
+		for j := range p.quotes {
+			if q := &p.quotes[j]; q.list == p.currentList && q.index >= i {
+				q.index++
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) expandQuotes() error {
 	for _, q := range p.quotes {
+		if q.index >= len(val2slice(*q.list)) {
+			return newError(ParseError, q.origin, "missing form after %s", q.origin.val)
+		}
+		// The expanded list spans the quote and the quoted form.
+		form := q.list.get(q.index)
 		list := newList()
-		list.push(Value{typ: idType, data: q.id})
-		list.push(q.list.get(q.index))
+		list.push(Value{typ: idType, data: q.id, origin: q.origin})
+		list.push(form)
+		list.origin = q.origin
+		list.origin.end = form.origin.end
 		q.list.replace(q.index, list)
 	}
+	return nil
+}
+
+// removeDiscards removes the forms preceded by #_. They are removed in
+// reverse order, so the indices of the remaining discards stay valid.
+func (p *parser) removeDiscards() error {
+	for i := len(p.discards) - 1; i >= 0; i-- {
+		d := p.discards[i]
+		vals := val2slice(*d.list)
+		if d.index >= len(vals) {
+			return newError(ParseError, d.origin, "missing form after %s", d.origin.val)
+		}
+		d.list.remove(d.index)
+	}
+	return nil
+}
+
+// reset drops the top-level form being parsed, after an error.
+func (p *parser) reset() {
+	root := p.stack[0]
+	*root = newList()
+	p.stack = p.stack[:1]
+	p.currentList = root
+	p.quotes, p.discards = nil, nil
 }
 
 func (p *parser) pushList(list *Value) {
@@ -132,6 +336,20 @@ func (p *parser) pushList(list *Value) {
 	p.currentList = list
 }
 
+// Message of the error returned when lists are left open at the end
+// of the input.
+const errUnclosed = "unclosed '(': reached end of input"
+
+// checkClosed returns an error at the end of the input if there are
+// lists left open. The error points at the innermost unclosed list.
+func (p *parser) checkClosed() error {
+	if len(p.stack) > 1 {
+		open := p.stack[len(p.stack)-1].origin
+		return newError(ParseError, open, errUnclosed)
+	}
+	return nil
+}
+
 func (p *parser) popList() {
 	p.stack = p.stack[:len(p.stack)-1]
 	p.currentList = p.stack[len(p.stack)-1]
@@ -147,6 +365,11 @@ func (list *Value) replace(index int, val Value) {
 	(*l.values)[index] = val
 }
 
+func (list *Value) remove(index int) {
+	l := list.data.(List)
+	*l.values = append((*l.values)[:index], (*l.values)[index+1:]...)
+}
+
 func (list Value) get(index int) Value {
 	l := list.data.(List)
 	return (*l.values)[index]
@@ -159,6 +382,10 @@ func newList(vals ...Value) Value {
 type Fn struct {
 	fn  func(args ...Value) (Value, error)
 	sig signature
+
+	// Set for functions registered with Define or Bind. The
+	// lists they return count towards the allocation limit.
+	host bool
 }
 
 // signature describes how many arguments a fn or form
@@ -172,9 +399,9 @@ type signature struct {
 	types   []Type
 }
 
-func newFn(fn func(args ...Value) (Value, error), minArgs, maxArgs int) Value {
-	sig := signature{name: "fn", minArgs: minArgs, maxArgs: maxArgs}
-	f := Fn{fn, sig}
+func newFn(name string, fn func(args ...Value) (Value, error), minArgs, maxArgs int) Value {
+	sig := signature{name: name, minArgs: minArgs, maxArgs: maxArgs}
+	f := Fn{fn: fn, sig: sig}
 	return Value{typ: fnType, data: &f}
 }
 
@@ -193,36 +420,88 @@ func newForm(name string, fn formFn, minArgs, maxArgs int, types []Type) Value {
 
 func parseString(i item) Value {
 	s := i.val
+	raw := s[0] == '`'
+
 	// Strip of quotes that are included in the token.
 	s = s[1:]
 	s = s[:len(s)-1]
 
+	if !raw {
+		s = unescape(s)
+	}
 	return Value{typ: stringType, data: s, origin: i}
 }
 
+// unescape decodes the escape sequences in s. The
+// sequences have already been validated by the lexer.
+func unescape(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u':
+			r, _ := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			b.WriteRune(rune(r))
+			i += 4
+		default: // " and \
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
 func parseIdentifier(i item) Value {
 	if i.val == "true" {
-		return Value{typ: boolType, data: true}
+		return Value{typ: boolType, data: true, origin: i}
 	}
 	if i.val == "false" {
-		return Value{typ: boolType, data: false}
+		return Value{typ: boolType, data: false, origin: i}
 	}
 	if i.val == "nil" {
-		return Value{typ: nilType, data: nil}
+		return Value{typ: nilType, data: nil, origin: i}
 	}
 	return Value{typ: idType, data: i.val, origin: i}
 }
 
 func parseNumber(i item) (Value, error) {
-	n, err := strconv.ParseInt(i.val, 10, 64)
+	// The lexer has validated the syntax, so underscores
+	// are only found between digits and can be dropped.
+	s := strings.ReplaceAll(i.val, "_", "")
+
+	if digits := strings.TrimLeft(s, "+-"); len(digits) > 1 && digits[0] == '0' &&
+		strings.ContainsRune("xXoObB", rune(digits[1])) {
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return Value{}, newError(ParseError, i, "number out of range")
+		}
+		v := int2val(Int(n))
+		v.origin = i
+		return v, nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		f, err := strconv.ParseFloat(i.val, 64)
+		f, err := strconv.ParseFloat(s, 64)
 		if err == nil {
 			v := float2val(Float(f))
 			v.origin = i
 			return v, nil
 		} else {
-			return Value{}, newError(i, "Invalid number")
+			return Value{}, newError(ParseError, i, "Invalid number")
 		}
 	}
 	v := int2val(Int(n))
@@ -257,14 +536,20 @@ func (v Value) String() string {
 		return fmt.Sprintf("%v", val2bool(v))
 	case fnType:
 		return fmt.Sprintf("<fn>")
+	case formType:
+		return fmt.Sprintf("<form %s>", val2form(v).sig.name)
+	case objectType:
+		return fmt.Sprintf("<object %s>", val2obj(v).Type())
 	default:
-		return v.String()
+		return fmt.Sprintf("<%s>", v.typ)
 	}
 }
 
 func (t Type) String() string {
 	var s string
 	switch t {
+	case invalidType:
+		s = "Invalid"
 	case intType:
 		s = "Int"
 	case floatType:
@@ -281,6 +566,10 @@ func (t Type) String() string {
 		s = "Nil"
 	case boolType:
 		s = "Bool"
+	case formType:
+		s = "Form"
+	case objectType:
+		s = "Object"
 	}
 	return s
 }
@@ -0,0 +1,220 @@
+package fatlisp
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(add 1 2)", "((add 1 2))"},
+		{"'a '(b c)", "((quote a) (quote (b c)))"},
+		{"#_a b", "(b)"},
+		{"(a #_(b c) d)", "((a d))"},
+		{"#_#_a b c", "(c)"},
+		{"#_'a 'b", "((quote b))"},
+		{"'#_a b", "((quote b))"},
+		{"(a '#_b c)", "((a (quote c)))"},
+		{"'#_#_a b c", "((quote c))"},
+		{"#_'#_a b c", "(c)"},
+		{"(a ; comment\n b) #| c |#", "((a b))"},
+	}
+
+	for _, test := range tests {
+		tree, err := Parse("test", test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+			continue
+		}
+		if s := tree.String(); s != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.input, test.expected, s)
+		}
+	}
+}
+
+func TestParseString(t *testing.T) {
+	tests := map[string]string{
+		`"plain"`:              "plain",
+		`""`:                   "",
+		`"a\"b\\c\n\t\r"`:      "a\"b\\c\n\t\r",
+		`"caf\u00e9 \u4e16"`:   "café 世",
+		"`raw\\n\n\"quoted\"`": "raw\\n\n\"quoted\"",
+	}
+
+	for input, expected := range tests {
+		tree, err := Parse("test", input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+			continue
+		}
+		if s, _ := tree.get(0).AsString(); s != expected {
+			t.Errorf("%s: expected %q, got %q", input, expected, s)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := map[string]string{
+		"42":        "42",
+		"-0x1F":     "-31",
+		"0b1010":    "10",
+		"0o17":      "15",
+		"1_000_000": "1000000",
+		"1e3":       "1000",
+		"-2.5E-1":   "-0.25",
+	}
+	for input, expected := range tests {
+		tree, err := Parse("test", input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+			continue
+		}
+		if s := tree.get(0).String(); s != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, s)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"(a #_)", "'", "(a ')"} {
+		if _, err := Parse("test", input); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestParseErrorDoesNotLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		Parse("test", "(a 1x) (b c)")
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: %d before, %d after", before, after)
+	}
+}
+
+func TestUnbalancedParens(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+		pos   Pos
+	}{
+		{"(a))", "unexpected ')'", Pos{"test", 1, 4, 3}},
+		{")", "unexpected ')'", Pos{"test", 1, 1, 0}},
+		{"(a (b)\n  (c", "unclosed '(': reached end of input", Pos{"test", 2, 3, 9}},
+	}
+
+	for _, test := range tests {
+		_, err := Parse("test", test.input)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%q: expected *Error, got %v", test.input, err)
+			continue
+		}
+		if e.Kind != ParseError || e.Msg != test.msg || e.Pos != test.pos {
+			t.Errorf("%q: expected %s %q at %s, got %s %q at %s",
+				test.input, ParseError, test.msg, test.pos, e.Kind, e.Msg, e.Pos)
+		}
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	tests := []struct {
+		input string
+		forms string
+		errs  []string
+	}{
+		{"(a) (b)", "((a) (b))", nil},
+		{"#_#_a b c", "(c)", nil},
+		{"(x) #_#_a b (c)", "((x) (c))", nil},
+		{"(a\n(b \"\\q\")\n(c)", "((c))", []string{
+			`test:2:5 unknown escape sequence \q`,
+		}}, // (a is the top-level form, (b is nested
+		{"(a 1x)\n(b))\n(c 0b2)\n(d)", "((b) (d))", []string{
+			"test:1:5 invalid character 'x' in number",
+			"test:2:4 unexpected ')'",
+			"test:3:6 expected binary digit in number",
+		}},
+		{"(def f (fn (x)\n  (add x 1)\n(def g 2)\n(h", "((def g 2))", []string{
+			"test:1:1 unclosed '(': reached end of input",
+			"test:4:1 unclosed '(': reached end of input",
+		}},
+		{"(a (b", "()", []string{"test:1:4 unclosed '(': reached end of input"}},
+		{"(a\n\"\n(b)", "()", []string{"test:2:1 unexpected EOF"}},
+		{"(a\n#|\n(b)", "()", []string{"test:2:1 unexpected EOF"}},
+		{"(a)\n'", "((a))", []string{"test:2:1 missing form after '"}},
+	}
+
+	for _, test := range tests {
+		forms, errs := ParseAll("test", test.input)
+		if forms.String() != test.forms {
+			t.Errorf("%q: expected forms %s, got %s", test.input, test.forms, forms)
+		}
+		msgs := []string{}
+		for _, e := range errs {
+			msgs = append(msgs, e.Error())
+		}
+		if strings.Join(msgs, "\n") != strings.Join(test.errs, "\n") {
+			t.Errorf("%q: expected errors\n%s\ngot\n%s", test.input,
+				strings.Join(test.errs, "\n"), strings.Join(msgs, "\n"))
+		}
+	}
+}
+
+func TestValueSpans(t *testing.T) {
+	tree, err := Parse("test", "(a (b true)\n  'c)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := val2slice(tree)[0]
+	inner := list.get(1)
+	quoted := list.get(2)
+
+	tests := []struct {
+		val        Value
+		start, end Pos
+	}{
+		{list, Pos{"test", 1, 1, 0}, Pos{"test", 2, 6, 17}},
+		{inner, Pos{"test", 1, 4, 3}, Pos{"test", 1, 12, 11}},
+		{inner.get(1), Pos{"test", 1, 7, 6}, Pos{"test", 1, 11, 10}},
+		{quoted, Pos{"test", 2, 3, 14}, Pos{"test", 2, 5, 16}},
+		{quoted.get(0), Pos{"test", 2, 3, 14}, Pos{"test", 2, 4, 15}},
+	}
+
+	for _, test := range tests {
+		if test.val.origin.pos != test.start || test.val.origin.end != test.end {
+			t.Errorf("%v: expected span %s-%s, got %s-%s", test.val,
+				test.start, test.end, test.val.origin.pos, test.val.origin.end)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+		pos   Pos
+	}{
+		{"1%", "invalid character '%' in number", Pos{"test", 1, 2, 1}},
+		{`"\%"`, `unknown escape sequence \%`, Pos{"test", 1, 2, 1}},
+		{`"ab\u12"`, `invalid escape sequence: \u needs 4 hex digits`, Pos{"test", 1, 4, 3}},
+	}
+
+	for _, test := range tests {
+		_, err := Parse("test", test.input)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%q: expected *Error, got %v", test.input, err)
+			continue
+		}
+		if e.Kind != LexError || e.Msg != test.msg || e.Pos != test.pos {
+			t.Errorf("%q: expected %s %q at %s, got %s %q at %s",
+				test.input, LexError, test.msg, test.pos, e.Kind, e.Msg, e.Pos)
+		}
+	}
+}
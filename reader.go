@@ -0,0 +1,37 @@
+package fatlisp
+
+import (
+	"io"
+)
+
+// Reader reads top-level forms one at a time from an io.Reader, so
+// large files or streams of s-expressions can be processed without
+// reading them into memory first.
+type Reader struct {
+	p   parser
+	err error
+}
+
+// NewReader returns a Reader that reads from r. name is
+// used as the file name in the positions of the forms.
+func NewReader(name string, r io.Reader) *Reader {
+	p := newParser(name, "")
+	p.lex = lexReader(name, r)
+	return &Reader{p: p}
+}
+
+// ReadForm reads the next top-level form. It returns io.EOF when
+// the input is exhausted. After an error, ReadForm keeps returning
+// that error. A form can be evaluated by wrapping it in a list:
+//
+//	results, err := ctx.Eval(fatlisp.ListValue(form))
+func (r *Reader) ReadForm() (Value, error) {
+	if r.err != nil {
+		return Value{}, r.err
+	}
+	form, err := r.p.parseForm()
+	if err != nil {
+		r.err = err
+	}
+	return form, err
+}
@@ -0,0 +1,84 @@
+package fatlisp
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReader(t *testing.T) {
+	src := "(add 1 2) 'héllo\n#_(skipped) ; comment\n  (puts \"a b\")  #| done |#"
+	// pos is the position of the element at index in the form.
+	expected := []struct {
+		form  string
+		index int
+		pos   Pos
+	}{
+		{"(add 1 2)", 0, Pos{"test", 1, 2, 1}},
+		{"(quote héllo)", 1, Pos{"test", 1, 12, 11}},
+		{"(puts a b)", 0, Pos{"test", 3, 4, 43}},
+	}
+
+	r := NewReader("test", iotest.OneByteReader(strings.NewReader(src)))
+	for _, exp := range expected {
+		form, err := r.ReadForm()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if s := form.String(); s != exp.form {
+			t.Errorf("expected %s, got %s", exp.form, s)
+		}
+		if pos := form.get(exp.index).origin.pos; pos != exp.pos {
+			t.Errorf("%s: expected position %s, got %s", exp.form, exp.pos, pos)
+		}
+	}
+	if _, err := r.ReadForm(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	r := NewReader("test", strings.NewReader("(a) (b"))
+	if _, err := r.ReadForm(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := r.ReadForm(); err == nil || err == io.EOF {
+		t.Errorf("expected error for unclosed list, got %v", err)
+	}
+
+	readErr := errors.New("read failed")
+	r = NewReader("test", iotest.ErrReader(readErr))
+	if _, err := r.ReadForm(); !errors.Is(err, readErr) {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
+
+func TestReaderQuoteDiscard(t *testing.T) {
+	tests := []struct {
+		input string
+		forms []string
+	}{
+		{"'#_a b c", []string{"(quote b)", "c"}},
+		{"#_#_a b c", []string{"c"}},
+		{"(x) #_#_a b (c)", []string{"(x)", "(c)"}},
+		{"#_#_a #_b c d", []string{"d"}},
+	}
+
+	for _, test := range tests {
+		r := NewReader("test", strings.NewReader(test.input))
+		for _, expected := range test.forms {
+			form, err := r.ReadForm()
+			if err != nil {
+				t.Fatalf("%q: unexpected error %v", test.input, err)
+			}
+			if s := form.String(); s != expected {
+				t.Errorf("%q: expected %s, got %s", test.input, expected, s)
+			}
+		}
+		if _, err := r.ReadForm(); err != io.EOF {
+			t.Errorf("%q: expected EOF, got %v", test.input, err)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package fatlisp
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
 
 func val2slice(v Value) []Value {
 	list := v.data.(List)
@@ -27,6 +31,10 @@ func val2form(v Value) *specialForm {
 	return v.data.(*specialForm)
 }
 
+func val2obj(v Value) reflect.Value {
+	return v.data.(reflect.Value)
+}
+
 func val2str(v Value) string {
 	return v.data.(string)
 }
@@ -80,10 +88,31 @@ func isNumeric(v Value) bool {
 }
 
 func typeError(v Value) error {
-	return newError(v.origin, "unexpected type %s", v.typ)
+	return newError(TypeError, v.origin, "unexpected type %s", v.typ)
+}
+
+// wrapError turns errors returned by Go functions into an *Error
+// located at origin. Errors that are already an *Error are returned
+// unchanged.
+func wrapError(err error, origin item) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Pos: origin.pos, End: origin.end, Kind: RuntimeError, Msg: err.Error(), Err: err}
+}
+
+// addFrame records the call of the function name at origin
+// in err, while the error is returned up the call stack.
+func addFrame(err error, name string, origin item) error {
+	var e *Error
+	if errors.As(err, &e) {
+		e.Frames = append(e.Frames, Frame{name, origin.pos})
+	}
+	return err
 }
 
-func newError(origin item, msg string, args ...interface{}) error {
+func newError(kind ErrorKind, origin item, msg string, args ...interface{}) error {
 	msg = fmt.Sprintf(msg, args...)
-	return fmt.Errorf("%s %s", origin.pos, msg)
+	return &Error{Pos: origin.pos, End: origin.end, Kind: kind, Msg: msg}
 }
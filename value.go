@@ -0,0 +1,112 @@
+package fatlisp
+
+// Kind identifies the type of a Value. It is the exported
+// counterpart of Type, for use by host programs.
+type Kind int
+
+const (
+	InvalidKind    = Kind(invalidType) // the kind of the zero Value
+	IntKind        = Kind(intType)
+	FloatKind      = Kind(floatType)
+	StringKind     = Kind(stringType)
+	ListKind       = Kind(listType)
+	IdentifierKind = Kind(idType)
+	FnKind         = Kind(fnType)
+	NilKind        = Kind(nilType)
+	BoolKind       = Kind(boolType)
+	FormKind       = Kind(formType)
+	ObjectKind     = Kind(objectType)
+)
+
+func (k Kind) String() string {
+	return Type(k).String()
+}
+
+// Kind returns the kind of v. The zero Value, which is returned
+// alongside errors, has kind InvalidKind and holds no value.
+func (v Value) Kind() Kind {
+	return Kind(v.typ)
+}
+
+func IntValue(i int64) Value {
+	return int2val(Int(i))
+}
+
+func FloatValue(f float64) Value {
+	return float2val(Float(f))
+}
+
+func StringValue(s string) Value {
+	return Value{typ: stringType, data: s}
+}
+
+func IdentifierValue(name string) Value {
+	return Value{typ: idType, data: name}
+}
+
+func BoolValue(b bool) Value {
+	return bool2val(b)
+}
+
+func NilValue() Value {
+	return Value{typ: nilType}
+}
+
+// ListValue returns a list containing vals. The slice is copied.
+func ListValue(vals ...Value) Value {
+	return newList(append([]Value(nil), vals...)...)
+}
+
+// AsInt returns the integer held by v. ok is false if v is not an Int.
+func (v Value) AsInt() (i int64, ok bool) {
+	if v.typ != intType {
+		return 0, false
+	}
+	return int64(val2int(v)), true
+}
+
+// AsFloat returns the float held by v. ok is false if v is not a Float.
+func (v Value) AsFloat() (f float64, ok bool) {
+	if v.typ != floatType {
+		return 0, false
+	}
+	return float64(val2float(v)), true
+}
+
+// AsString returns the string held by v. ok is false if v is not a String.
+func (v Value) AsString() (s string, ok bool) {
+	if v.typ != stringType {
+		return "", false
+	}
+	return val2str(v), true
+}
+
+// AsIdentifier returns the name of an identifier. ok is false if v
+// is not an Identifier.
+func (v Value) AsIdentifier() (name string, ok bool) {
+	if v.typ != idType {
+		return "", false
+	}
+	return val2str(v), true
+}
+
+// AsBool returns the boolean held by v. ok is false if v is not a Bool.
+func (v Value) AsBool() (b bool, ok bool) {
+	if v.typ != boolType {
+		return false, false
+	}
+	return val2bool(v), true
+}
+
+// AsList returns a copy of the elements of v. ok is false if v is not a List.
+func (v Value) AsList() (vals []Value, ok bool) {
+	if v.typ != listType {
+		return nil, false
+	}
+	return append([]Value(nil), val2slice(v)...), true
+}
+
+// IsNil reports whether v is nil.
+func (v Value) IsNil() bool {
+	return v.typ == nilType
+}
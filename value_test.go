@@ -0,0 +1,62 @@
+package fatlisp
+
+import (
+	"testing"
+)
+
+func TestValueAccessors(t *testing.T) {
+	ctx := NewContext()
+	v := evalString(t, ctx, `'(1 2.5 "three" four true nil)`)
+
+	if v.Kind() != ListKind {
+		t.Fatalf("expected List, got %s", v.Kind())
+	}
+	vals, _ := v.AsList()
+	if len(vals) != 6 {
+		t.Fatalf("expected 6 values, got %d", len(vals))
+	}
+	if i, ok := vals[0].AsInt(); !ok || i != 1 {
+		t.Errorf("AsInt: got %v, %v", i, ok)
+	}
+	if _, ok := vals[0].AsFloat(); ok {
+		t.Errorf("AsFloat should fail on Int")
+	}
+	if f, ok := vals[1].AsFloat(); !ok || f != 2.5 {
+		t.Errorf("AsFloat: got %v, %v", f, ok)
+	}
+	if s, ok := vals[2].AsString(); !ok || s != "three" {
+		t.Errorf("AsString: got %v, %v", s, ok)
+	}
+	if s, ok := vals[3].AsIdentifier(); !ok || s != "four" {
+		t.Errorf("AsIdentifier: got %v, %v", s, ok)
+	}
+	if b, ok := vals[4].AsBool(); !ok || !b {
+		t.Errorf("AsBool: got %v, %v", b, ok)
+	}
+	if !vals[5].IsNil() {
+		t.Errorf("IsNil: got %s", vals[5].Kind())
+	}
+}
+
+func TestValueConstructors(t *testing.T) {
+	v := ListValue(IntValue(1), FloatValue(2.5), StringValue("s"), BoolValue(false), NilValue())
+	if s := v.String(); s != "(1 2.5 s false nil)" {
+		t.Errorf("unexpected list %s", s)
+	}
+}
+
+func TestZeroValue(t *testing.T) {
+	var v Value
+	if v.Kind() != InvalidKind {
+		t.Errorf("expected Invalid, got %s", v.Kind())
+	}
+	if _, ok := v.AsInt(); ok {
+		t.Errorf("AsInt should fail on the zero Value")
+	}
+	if v.IsNil() {
+		t.Errorf("IsNil should be false for the zero Value")
+	}
+	if s := v.String(); s != "<Invalid>" {
+		t.Errorf("unexpected string %s", s)
+	}
+}